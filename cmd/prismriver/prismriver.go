@@ -1,15 +1,22 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
 	"github.com/Safety-Third/prismriver/assets"
 	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/downloader"
+	"github.com/Safety-Third/prismriver/internal/app/library"
+	"github.com/Safety-Third/prismriver/internal/app/player"
+	"github.com/Safety-Third/prismriver/internal/app/scheduler"
 	"github.com/Safety-Third/prismriver/internal/app/server"
 )
 
@@ -18,28 +25,79 @@ func main() {
 	viper.SetEnvPrefix("prismriver")
 	viper.AutomaticEnv()
 
+	viper.SetDefault(constants.ADMIN_TOKEN, "")
+	viper.SetDefault(constants.ALLOWED_DOMAINS, []string{})
 	viper.SetDefault(constants.ALLOWED_TYPES, []string{"soundcloud", "youtube"})
+	viper.SetDefault(constants.ALLOW_AGE_RESTRICTED, true)
+	viper.SetDefault(constants.ALLOW_LIVESTREAMS, false)
+	viper.SetDefault(constants.AUDIO_PROFILE, "opus")
+	viper.SetDefault(constants.AUTO_MIGRATE, true)
+	viper.SetDefault(constants.BUMP_CREDITS, 2)
 	viper.SetDefault(constants.DATA, "/var/lib/prismriver")
+	viper.SetDefault(constants.DB_DRIVER, "sqlite")
 	viper.SetDefault(constants.DB_HOST, "localhost")
 	viper.SetDefault(constants.DB_NAME, "prismriver")
 	viper.SetDefault(constants.DB_PASSWORD, "prismriver")
 	viper.SetDefault(constants.DB_PORT, "5432")
 	viper.SetDefault(constants.DB_USER, "prismriver")
+	viper.SetDefault(constants.DENIED_DOMAINS, []string{})
 	viper.SetDefault(constants.DOWNLOAD_FORMAT, "bestvideo+bestaudio/best")
+	viper.SetDefault(constants.FAIRNESS_WINDOW, "1h")
+	viper.SetDefault(constants.LIBRARY_DIRS, []string{})
+	viper.SetDefault(constants.LIBRARY_SCAN_INTERVAL, "6h")
+	viper.SetDefault(constants.LIBRARY_WATCH, false)
+	viper.SetDefault(constants.MAX_DURATION, "0")
 	viper.SetDefault(constants.ORIGIN, "")
+	viper.SetDefault(constants.PREFETCH, false)
+	viper.SetDefault(constants.PREFETCH_INTERVAL, "1m")
+	viper.SetDefault(constants.PREFETCH_LIMIT, 50)
+	viper.SetDefault(constants.PROGRESSIVE_PLAYBACK, true)
+	viper.SetDefault(constants.QUEUE_ORDERING, "balanced")
+	viper.SetDefault(constants.SKIP_SEGMENT_CATEGORIES, []string{"music_offtopic", "selfpromo", "sponsor"})
+	viper.SetDefault(constants.STREAM_MAX_DURATION, "1h")
+	viper.SetDefault(constants.TTS_COMMAND, "espeak")
+	viper.SetDefault(constants.UPLOAD_MAX_SIZE, 200*1024*1024)
+	viper.SetDefault(constants.UPLOAD_TYPES, []string{"audio/flac", "audio/mp4", "audio/mpeg", "audio/ogg", "audio/wav",
+		"audio/webm", "audio/x-flac", "audio/x-wav", "video/mp4", "video/webm"})
 	viper.SetDefault(constants.VERBOSITY, "info")
+	viper.SetDefault(constants.VIDEO_PROFILE, "")
 	viper.SetDefault(constants.VIDEO_TRANSCODING, true)
 
 	envVars := []string{
+		constants.ADMIN_TOKEN,
+		constants.ALLOWED_DOMAINS,
 		constants.ALLOWED_TYPES,
+		constants.ALLOW_AGE_RESTRICTED,
+		constants.ALLOW_LIVESTREAMS,
+		constants.AUDIO_PROFILE,
+		constants.AUTO_MIGRATE,
+		constants.BUMP_CREDITS,
+		constants.DB_DRIVER,
 		constants.DB_HOST,
 		constants.DB_NAME,
 		constants.DB_PASSWORD,
 		constants.DB_PORT,
 		constants.DB_USER,
+		constants.DENIED_DOMAINS,
 		constants.DOWNLOAD_FORMAT,
+		constants.FAIRNESS_WINDOW,
+		constants.LIBRARY_DIRS,
+		constants.LIBRARY_SCAN_INTERVAL,
+		constants.LIBRARY_WATCH,
+		constants.MAX_DURATION,
 		constants.ORIGIN,
+		constants.PREFETCH,
+		constants.PREFETCH_INTERVAL,
+		constants.PREFETCH_LIMIT,
+		constants.PROGRESSIVE_PLAYBACK,
+		constants.QUEUE_ORDERING,
+		constants.SKIP_SEGMENT_CATEGORIES,
+		constants.STREAM_MAX_DURATION,
+		constants.TTS_COMMAND,
+		constants.UPLOAD_MAX_SIZE,
+		constants.UPLOAD_TYPES,
 		constants.VERBOSITY,
+		constants.VIDEO_PROFILE,
 		constants.VIDEO_TRANSCODING,
 	}
 
@@ -63,20 +121,104 @@ func main() {
 	// trust me, there isn't a nicer way to do this without type hacking or structs to track things like variable
 	// privacy.
 	logrus.Debugf("current configuration:")
+	logrus.Debugf("%v: [hidden]", constants.ADMIN_TOKEN)
+	logrus.Debugf("%v:", constants.ALLOWED_DOMAINS)
+	for _, domain := range viper.GetStringSlice(constants.ALLOWED_DOMAINS) {
+		logrus.Debugf("- %v", domain)
+	}
 	logrus.Debugf("%v:", constants.ALLOWED_TYPES)
 	for _, allowedType := range viper.GetStringSlice(constants.ALLOWED_TYPES) {
 		logrus.Debugf("- %v", allowedType)
 	}
+	logrus.Debugf("%v: %v", constants.ALLOW_AGE_RESTRICTED, viper.GetBool(constants.ALLOW_AGE_RESTRICTED))
+	logrus.Debugf("%v: %v", constants.ALLOW_LIVESTREAMS, viper.GetBool(constants.ALLOW_LIVESTREAMS))
+	logrus.Debugf("%v: %v", constants.AUDIO_PROFILE, viper.GetString(constants.AUDIO_PROFILE))
+	logrus.Debugf("%v: %v", constants.AUTO_MIGRATE, viper.GetBool(constants.AUTO_MIGRATE))
+	logrus.Debugf("%v: %v", constants.BUMP_CREDITS, viper.GetInt(constants.BUMP_CREDITS))
+	logrus.Debugf("%v: %v", constants.DB_DRIVER, viper.GetString(constants.DB_DRIVER))
 	logrus.Debugf("%v: %v", constants.DB_HOST, viper.GetString(constants.DB_HOST))
 	logrus.Debugf("%v: %v", constants.DB_NAME, viper.GetString(constants.DB_NAME))
 	logrus.Debugf("%v: [hidden]", constants.DB_PASSWORD)
 	logrus.Debugf("%v: %v", constants.DB_PORT, viper.GetString(constants.DB_PORT))
 	logrus.Debugf("%v: %v", constants.DB_USER, viper.GetString(constants.DB_USER))
+	logrus.Debugf("%v:", constants.DENIED_DOMAINS)
+	for _, domain := range viper.GetStringSlice(constants.DENIED_DOMAINS) {
+		logrus.Debugf("- %v", domain)
+	}
 	logrus.Debugf("%v: %v", constants.DOWNLOAD_FORMAT, viper.GetString(constants.DOWNLOAD_FORMAT))
+	logrus.Debugf("%v:", constants.EXTRACTOR_RULES)
+	for extractor := range viper.GetStringMap(constants.EXTRACTOR_RULES) {
+		logrus.Debugf("- %v", extractor)
+	}
+	logrus.Debugf("%v: %v", constants.FAIRNESS_WINDOW, viper.GetDuration(constants.FAIRNESS_WINDOW))
+	logrus.Debugf("%v:", constants.LIBRARY_DIRS)
+	for _, dir := range viper.GetStringSlice(constants.LIBRARY_DIRS) {
+		logrus.Debugf("- %v", dir)
+	}
+	logrus.Debugf("%v: %v", constants.LIBRARY_SCAN_INTERVAL, viper.GetDuration(constants.LIBRARY_SCAN_INTERVAL))
+	logrus.Debugf("%v: %v", constants.LIBRARY_WATCH, viper.GetBool(constants.LIBRARY_WATCH))
+	logrus.Debugf("%v: %v", constants.MAX_DURATION, viper.GetDuration(constants.MAX_DURATION))
 	logrus.Debugf("%v: %v", constants.ORIGIN, viper.GetString(constants.ORIGIN))
+	logrus.Debugf("%v:", constants.OWNER_WEIGHTS)
+	var weights []player.OwnerWeight
+	if err := viper.UnmarshalKey(constants.OWNER_WEIGHTS, &weights); err == nil {
+		for _, weight := range weights {
+			logrus.Debugf("- %v: %v", weight.Owner, weight.Weight)
+		}
+	}
+	logrus.Debugf("%v: %v", constants.PREFETCH, viper.GetBool(constants.PREFETCH))
+	logrus.Debugf("%v: %v", constants.PREFETCH_INTERVAL, viper.GetDuration(constants.PREFETCH_INTERVAL))
+	logrus.Debugf("%v: %v", constants.PREFETCH_LIMIT, viper.GetInt(constants.PREFETCH_LIMIT))
+	logrus.Debugf("%v: %v", constants.PROGRESSIVE_PLAYBACK, viper.GetBool(constants.PROGRESSIVE_PLAYBACK))
+	logrus.Debugf("%v: %v", constants.QUEUE_ORDERING, viper.GetString(constants.QUEUE_ORDERING))
+	logrus.Debugf("%v:", constants.QUIET_HOURS)
+	var quietHours []player.QuietHours
+	if err := viper.UnmarshalKey(constants.QUIET_HOURS, &quietHours); err == nil {
+		for _, hours := range quietHours {
+			logrus.Debugf("- %v-%v: max volume %v, max length %v, reject video %v", hours.Start, hours.End,
+				hours.MaxVolume, hours.MaxLength, hours.RejectVideo)
+		}
+	}
+	logrus.Debugf("%v:", constants.SKIP_SEGMENT_CATEGORIES)
+	for _, category := range viper.GetStringSlice(constants.SKIP_SEGMENT_CATEGORIES) {
+		logrus.Debugf("- %v", category)
+	}
+	logrus.Debugf("%v: %v", constants.STREAM_MAX_DURATION, viper.GetDuration(constants.STREAM_MAX_DURATION))
+	logrus.Debugf("%v:", constants.TRANSCODING_PROFILES)
+	for name := range downloader.GetProfiles() {
+		logrus.Debugf("- %v", name)
+	}
+	logrus.Debugf("%v: %v", constants.TTS_COMMAND, viper.GetString(constants.TTS_COMMAND))
+	logrus.Debugf("%v: %v", constants.UPLOAD_MAX_SIZE, viper.GetInt64(constants.UPLOAD_MAX_SIZE))
+	logrus.Debugf("%v:", constants.UPLOAD_TYPES)
+	for _, uploadType := range viper.GetStringSlice(constants.UPLOAD_TYPES) {
+		logrus.Debugf("- %v", uploadType)
+	}
 	logrus.Debugf("%v: %v", constants.VERBOSITY, viper.GetString(constants.VERBOSITY))
+	logrus.Debugf("%v: %v", constants.VIDEO_PROFILE, viper.GetString(constants.VIDEO_PROFILE))
 	logrus.Debugf("%v: %v", constants.VIDEO_TRANSCODING, viper.GetBool(constants.VIDEO_TRANSCODING))
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			migrateCommand(os.Args[2:])
+		case "import-segments":
+			if len(os.Args) < 3 {
+				logrus.Fatalf("usage: prismriver import-segments sponsorTimes.csv")
+			}
+			importSegments(os.Args[2])
+		case "rebuild-index":
+			stats, err := db.RebuildIndex()
+			if err != nil {
+				logrus.Fatalf("could not rebuild search index: %v", err)
+			}
+			logrus.Infof("rebuilt search index: %v of %v media indexed", stats.Indexed, stats.Media)
+		default:
+			logrus.Fatalf("unknown command %v", os.Args[1])
+		}
+		return
+	}
+
 	dataDir := viper.GetString(constants.DATA)
 	if err := os.MkdirAll(path.Join(dataDir, "internal"), os.ModeDir|0755); err != nil {
 		logrus.Fatalf("error creating data directories: %v", err)
@@ -97,6 +239,65 @@ func main() {
 	if err := beQuietFile.Close(); err != nil {
 		logrus.Warnf("error closing reader on bequiet.opus: %v", err)
 	}
+	if result, err := downloader.Probe(beQuietPath); err != nil {
+		logrus.Warnf("could not probe length of bequiet.opus, using the default: %v", err)
+	} else {
+		db.BeQuiet.Length = result.Length()
+		db.BeQuiet.Save()
+	}
+
+	go downloader.BackfillMetadata()
+	library.Start()
+	player.GetPrefetcher()
+	scheduler.Start()
 
 	server.CreateRouter()
 }
+
+// migrateCommand handles the migrate subcommand, which either lists the status of each database migration or applies
+// the pending ones.
+func migrateCommand(args []string) {
+	if len(args) == 0 {
+		logrus.Fatalf("usage: prismriver migrate status|up")
+	}
+	switch args[0] {
+	case "status":
+		statuses, err := db.GetMigrationStatus()
+		if err != nil {
+			logrus.Fatalf("could not get migration status: %v", err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4v  %-40v %v\n", status.Version, status.Name, applied)
+		}
+	case "up":
+		if err := db.Migrate(); err != nil {
+			logrus.Fatalf("could not migrate database: %v", err)
+		}
+		logrus.Infof("database is up to date")
+	default:
+		logrus.Fatalf("unknown migrate command %v", args[0])
+	}
+}
+
+// importSegments handles the import-segments subcommand, which imports skip segments from a SponsorBlock database
+// dump.
+func importSegments(filePath string) {
+	dump, err := os.Open(filePath)
+	if err != nil {
+		logrus.Fatalf("could not open segment dump: %v", err)
+	}
+	defer func() {
+		if err := dump.Close(); err != nil {
+			logrus.Errorf("error closing segment dump: %v", err)
+		}
+	}()
+	count, err := db.ImportSegments(dump)
+	if err != nil {
+		logrus.Fatalf("could not import segments after importing %v: %v", count, err)
+	}
+	logrus.Infof("imported %v segments", count)
+}
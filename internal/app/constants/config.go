@@ -4,10 +4,26 @@ package constants
 // these should very much be camelCased but viper requires a string replacer in order to parse environment variable
 // names, which would be a pain to get working with anything that isn't snake_cased.
 const (
+	// ADMIN_TOKEN specifies the token required for admin requests. Admin requests are disabled if unset.
+	ADMIN_TOKEN = "admin_token"
+	// ALLOWED_DOMAINS specifies the domains that media URLs are limited to. Any domain is allowed if empty.
+	ALLOWED_DOMAINS = "allowed_domains"
 	// ALLOWED_TYPES specifies the media types allowed to be downloaded.
 	ALLOWED_TYPES = "allowed_types"
+	// ALLOW_AGE_RESTRICTED specifies whether or not age restricted media is allowed.
+	ALLOW_AGE_RESTRICTED = "allow_age_restricted"
+	// ALLOW_LIVESTREAMS specifies whether or not livestreams are allowed.
+	ALLOW_LIVESTREAMS = "allow_livestreams"
+	// AUDIO_PROFILE specifies the name of the transcoding profile used for audio media.
+	AUDIO_PROFILE = "audio_profile"
+	// AUTO_MIGRATE specifies whether or not to apply pending database migrations on startup.
+	AUTO_MIGRATE = "auto_migrate"
+	// BUMP_CREDITS specifies how many times each owner can bump one of their queue items per hour.
+	BUMP_CREDITS = "bump_credits"
 	// DATA specifies the data storage directory.
 	DATA = "data_dir"
+	// DB_DRIVER specifies which database to use, either sqlite or postgres.
+	DB_DRIVER = "db_driver"
 	// DB_HOST specifies the database connection host.
 	DB_HOST = "db_host"
 	// DB_NAME specifies the database name.
@@ -18,12 +34,54 @@ const (
 	DB_PORT = "db_port"
 	// DB_USER specifies the database connection user.
 	DB_USER = "db_user"
+	// DENIED_DOMAINS specifies domains that media URLs are never allowed from.
+	DENIED_DOMAINS = "denied_domains"
 	// DOWNLOAD_FORMAT specifies which format to use for downloading media.
 	DOWNLOAD_FORMAT = "download_format"
+	// EXTRACTOR_RULES specifies per-extractor overrides of allow_age_restricted, allow_livestreams and max_duration.
+	EXTRACTOR_RULES = "extractor_rules"
+	// FAIRNESS_WINDOW specifies how far back play history is taken into account when ordering the queue fairly.
+	FAIRNESS_WINDOW = "fairness_window"
+	// LIBRARY_DIRS specifies directories of local music files to make available as media.
+	LIBRARY_DIRS = "library_dirs"
+	// LIBRARY_SCAN_INTERVAL specifies how often to rescan the library directories. 0 disables periodic rescans.
+	LIBRARY_SCAN_INTERVAL = "library_scan_interval"
+	// LIBRARY_WATCH specifies whether or not to rescan the library directories when their contents change.
+	LIBRARY_WATCH = "library_watch"
+	// MAX_DURATION specifies the maximum length of media. 0 allows any length.
+	MAX_DURATION = "max_duration"
 	// ORIGIN specifies an optional origin to accept cross-origin requests from.
 	ORIGIN = "origin"
+	// OWNER_WEIGHTS specifies how much play time each owner gets relative to others with the weighted queue ordering.
+	OWNER_WEIGHTS = "owner_weights"
+	// PREFETCH specifies whether or not to prefetch frequently played media in the background.
+	PREFETCH = "prefetch"
+	// PREFETCH_INTERVAL specifies how long to wait between background prefetches.
+	PREFETCH_INTERVAL = "prefetch_interval"
+	// PREFETCH_LIMIT specifies how many of the most frequently played media are considered for prefetching.
+	PREFETCH_LIMIT = "prefetch_limit"
+	// PROGRESSIVE_PLAYBACK specifies whether or not to start playing media while it's still being transcoded.
+	PROGRESSIVE_PLAYBACK = "progressive_playback"
+	// QUEUE_ORDERING specifies the name of the strategy used to order the queue on startup.
+	QUEUE_ORDERING = "queue_ordering"
+	// QUIET_HOURS specifies windows of time during which the volume is capped and long or video media can be rejected.
+	QUIET_HOURS = "quiet_hours"
+	// SKIP_SEGMENT_CATEGORIES specifies the categories of segments that are skipped during playback.
+	SKIP_SEGMENT_CATEGORIES = "skip_segment_categories"
+	// STREAM_MAX_DURATION specifies how long livestreams and radio streams are played for before moving on.
+	STREAM_MAX_DURATION = "stream_max_duration"
+	// TRANSCODING_PROFILES specifies named sets of transcoding options that can be selected for media.
+	TRANSCODING_PROFILES = "transcoding_profiles"
+	// TTS_COMMAND specifies the espeak compatible text to speech command used to generate spoken announcements.
+	TTS_COMMAND = "tts_command"
+	// UPLOAD_MAX_SIZE specifies the maximum size in bytes of uploaded media files.
+	UPLOAD_MAX_SIZE = "upload_max_size"
+	// UPLOAD_TYPES specifies the MIME types allowed for uploaded media files.
+	UPLOAD_TYPES = "upload_types"
 	// VERBOSITY specifies the logging verbosity.
 	VERBOSITY = "verbosity"
+	// VIDEO_PROFILE specifies the name of the transcoding profile used for video media.
+	VIDEO_PROFILE = "video_profile"
 	// VIDEO_TRANSCODING specifies whether or not to enable video transcoding.
 	VIDEO_TRANSCODING = "video_transcoding"
 
@@ -0,0 +1,214 @@
+package db
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Kinds of Blocks, which determine what their patterns are matched against.
+const (
+	// BLOCK_MEDIA blocks a single Media item, identified by a pattern of the form type/id.
+	BLOCK_MEDIA = "media"
+	// BLOCK_TITLE blocks Media whose title matches a regular expression.
+	BLOCK_TITLE = "title"
+	// BLOCK_UPLOADER blocks Media from an uploader or channel, ignoring case.
+	BLOCK_UPLOADER = "uploader"
+	// BLOCK_URL blocks Media with an exact URL.
+	BLOCK_URL = "url"
+)
+
+// sqliteDriver is the name of the SQLite driver registered with support for REGEXP, which SQLite leaves up to the
+// application to provide.
+const sqliteDriver = "sqlite3_prismriver"
+
+// patterns caches compiled regular expressions used by the SQLite REGEXP function.
+var patterns sync.Map
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("regexp", matchPattern, true)
+		},
+	})
+}
+
+// Block represents a rule preventing matching Media from being queued or shown.
+type Block struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Kind    string `gorm:"not null" json:"kind"`
+	Pattern string `gorm:"not null" json:"pattern"`
+	Reason  string `json:"reason"`
+}
+
+// Validate returns an error if the Block has an unknown kind or an invalid pattern.
+func (b Block) Validate() error {
+	if b.Pattern == "" {
+		return errors.New("block pattern cannot be empty")
+	}
+	switch b.Kind {
+	case BLOCK_MEDIA:
+		if parts := strings.SplitN(b.Pattern, "/", 2); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return errors.Errorf("media block pattern %v is not of the form type/id", b.Pattern)
+		}
+	case BLOCK_TITLE:
+		if _, err := regexp.Compile(b.Pattern); err != nil {
+			return errors.Wrap(err, "invalid title block pattern")
+		}
+		if err := validatePostgresPattern(b.Pattern); err != nil {
+			return errors.Wrap(err, "invalid title block pattern")
+		}
+	case BLOCK_UPLOADER, BLOCK_URL:
+	default:
+		return errors.Errorf("unknown block kind %v", b.Kind)
+	}
+	return nil
+}
+
+// Matches returns whether or not the given Media is blocked by the Block.
+func (b Block) Matches(media Media) bool {
+	switch b.Kind {
+	case BLOCK_MEDIA:
+		return b.Pattern == media.Type+"/"+media.ID
+	case BLOCK_TITLE:
+		matched, err := matchPattern(b.Pattern, media.Title)
+		return err == nil && matched
+	case BLOCK_UPLOADER:
+		return strings.EqualFold(b.Pattern, media.Uploader)
+	case BLOCK_URL:
+		return b.Pattern == media.URL
+	}
+	return false
+}
+
+// AddBlock validates and stores a new Block, filling in its ID.
+func AddBlock(block *Block) error {
+	if err := block.Validate(); err != nil {
+		return err
+	}
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Create(block).Error
+}
+
+// UpdateBlock validates and stores changes to an existing Block.
+func UpdateBlock(block Block) error {
+	if err := block.Validate(); err != nil {
+		return err
+	}
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Save(&block).Error
+}
+
+// DeleteBlock removes a Block, allowing the Media it matched to be queued again.
+func DeleteBlock(block Block) error {
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Delete(&block).Error
+}
+
+// GetBlock attempts to return the Block identified by id, and returns an error if not found.
+func GetBlock(id uint) (Block, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return Block{}, err
+	}
+	var block Block
+	err = db.First(&block, id).Error
+	return block, err
+}
+
+// GetBlocks returns every Block, oldest first.
+func GetBlocks() ([]Block, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, err
+	}
+	var blocks []Block
+	err = db.Order("id").Find(&blocks).Error
+	return blocks, err
+}
+
+// FindBlock returns the first Block matching the given Media, if there is one.
+func FindBlock(media Media) (Block, bool, error) {
+	blocks, err := GetBlocks()
+	if err != nil {
+		return Block{}, false, err
+	}
+	for _, block := range blocks {
+		if block.Matches(media) {
+			return block, true, nil
+		}
+	}
+	return Block{}, false, nil
+}
+
+// FindURLBlock returns the Block matching the given URL, if there is one. Unlike FindBlock, this can be used before
+// anything else is known about the Media at the URL.
+func FindURLBlock(url string) (Block, bool, error) {
+	blocks, err := GetBlocks()
+	if err != nil {
+		return Block{}, false, err
+	}
+	for _, block := range blocks {
+		if block.Kind == BLOCK_URL && block.Pattern == url {
+			return block, true, nil
+		}
+	}
+	return Block{}, false, nil
+}
+
+// validatePostgresPattern returns an error if PostgreSQL can't use the given regular expression. Titles are matched by
+// PostgreSQL itself when searching, whose regular expressions don't accept everything that Go's do, so title patterns
+// have to be valid for both.
+func validatePostgresPattern(pattern string) error {
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	if db.Dialector.Name() != DRIVER_POSTGRES {
+		return nil
+	}
+	return db.Exec("SELECT '' ~ ?;", pattern).Error
+}
+
+// notBlocked limits tx to Media that isn't matched by any Block.
+func notBlocked(tx *gorm.DB) *gorm.DB {
+	titleCondition := "media.title REGEXP blocks.pattern"
+	if tx.Dialector.Name() == DRIVER_POSTGRES {
+		titleCondition = "media.title ~ blocks.pattern"
+	}
+	return tx.Where("NOT EXISTS (SELECT 1 FROM blocks WHERE "+
+		"(blocks.kind = ? AND blocks.pattern = media.type || '/' || media.id) OR "+
+		"(blocks.kind = ? AND "+titleCondition+") OR "+
+		"(blocks.kind = ? AND LOWER(blocks.pattern) = LOWER(COALESCE(media.uploader, ''))) OR "+
+		"(blocks.kind = ? AND blocks.pattern = media.url))", BLOCK_MEDIA, BLOCK_TITLE, BLOCK_UPLOADER, BLOCK_URL)
+}
+
+// matchPattern returns whether or not text matches the regular expression pattern, compiling each pattern only once.
+func matchPattern(pattern string, text string) (bool, error) {
+	compiled, ok := patterns.Load(pattern)
+	if !ok {
+		var err error
+		if compiled, err = regexp.Compile(pattern); err != nil {
+			return false, err
+		}
+		patterns.Store(pattern, compiled)
+	}
+	return compiled.(*regexp.Regexp).MatchString(text), nil
+}
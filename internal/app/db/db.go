@@ -5,59 +5,93 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 
 	"github.com/Safety-Third/prismriver/internal/app/constants"
 
 	"fmt"
-	"math"
+	"net"
+	"net/url"
 	"path"
-	"strings"
 	"sync"
+	"time"
 )
 
+// Database drivers that can be selected with the db_driver setting.
+const (
+	DRIVER_POSTGRES = "postgres"
+	DRIVER_SQLITE   = "sqlite"
+)
+
+// localTypes are the types of Media that aren't downloaded from a URL.
+var localTypes = []string{"internal", "library", "upload"}
+
 var db *gorm.DB
 var err error
 var once sync.Once
+var migrateErr error
+var migrateOnce sync.Once
 
-// BeQuiet is built-in media used for the "Be Quiet!" feature.
+// BeQuiet is built-in media used for the "Be Quiet!" feature when no other announcement is chosen. Its length is
+// probed from the bundled file on startup, and is otherwise the 3.71 seconds of the file that has always been bundled.
 var BeQuiet = &Media{
-	ID:     "bequiet",
-	Length: 3710000000,
+	ID: "bequiet",
+	// Media.Length is in seconds multiplied by time.Millisecond.
+	Length: uint64(3.71 * float64(time.Millisecond)),
 	Title:  "Please Be Quiet!",
 	Type:   "internal",
 }
 
-// GetDatabase gets the instance of the database connection used for the application.
+// GetDatabase gets the instance of the database connection used for the application, making sure that the schema is
+// up to date first.
 func GetDatabase() (*gorm.DB, error) {
-	once.Do(func() {
-		db, err = gorm.Open(sqlite.Open(path.Join(viper.GetString(constants.DATA), "prismriver.db")), &gorm.Config{})
-		if err != nil {
-			return
-		}
-		if err = db.AutoMigrate(&Media{}); err != nil {
-			return
-		}
-		// manual sql queries to set up search indexing
-		if err = db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS media_fts USING fts5(title, content=media, tokenize='porter trigram');").Error; err != nil {
-			return
-		}
-		if err = db.Exec("CREATE TRIGGER IF NOT EXISTS media_fts_insert AFTER INSERT ON media BEGIN " +
-			"INSERT INTO media_fts (rowid, title) VALUES (new.rowid, new.title); END;").Error; err != nil {
-			return
-		}
-		if err = db.Exec("CREATE TRIGGER IF NOT EXISTS media_fts_delete AFTER DELETE ON media BEGIN " +
-			"INSERT INTO media_fts (media_fts, rowid, title) VALUES ('delete', old.rowid, old.title); END;").Error; err != nil {
-			return
+	db, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	migrateOnce.Do(func() {
+		if viper.GetBool(constants.AUTO_MIGRATE) {
+			migrateErr = Migrate()
+		} else {
+			var pending []migration
+			if pending, migrateErr = pendingMigrations(db); migrateErr == nil && len(pending) > 0 {
+				migrateErr = errors.New(fmt.Sprintf("database has %v pending migrations, run prismriver migrate up",
+					len(pending)))
+			}
 		}
-		if err = db.Exec("CREATE TRIGGER IF NOT EXISTS media_fts_insert UPDATE ON media BEGIN " +
-			"INSERT INTO media_fts (media_fts, rowid, title) VALUES ('delete', old.rowid, old.title);" +
-			"INSERT INTO media_fts (rowid, title) VALUES (new.rowid, new.title); END;").Error; err != nil {
+		if migrateErr != nil {
 			return
 		}
-		if err = db.FirstOrCreate(BeQuiet).Error; err != nil {
+		migrateErr = db.FirstOrCreate(BeQuiet).Error
+	})
+	return db, migrateErr
+}
+
+// connect opens the database connection without touching the schema.
+func connect() (*gorm.DB, error) {
+	once.Do(func() {
+		var dialector gorm.Dialector
+		switch driver := viper.GetString(constants.DB_DRIVER); driver {
+		case DRIVER_POSTGRES:
+			// A URL takes care of escaping credentials, unlike the key=value format.
+			dsn := url.URL{
+				Scheme: "postgres",
+				User:   url.UserPassword(viper.GetString(constants.DB_USER), viper.GetString(constants.DB_PASSWORD)),
+				Host:   net.JoinHostPort(viper.GetString(constants.DB_HOST), viper.GetString(constants.DB_PORT)),
+				Path:   viper.GetString(constants.DB_NAME),
+			}
+			dialector = postgres.Open(dsn.String())
+		case DRIVER_SQLITE, "":
+			dialector = &sqlite.Dialector{
+				DriverName: sqliteDriver,
+				DSN:        path.Join(viper.GetString(constants.DATA), "prismriver.db"),
+			}
+		default:
+			err = errors.New(fmt.Sprintf("unknown database driver %v", driver))
 			return
 		}
+		db, err = gorm.Open(dialector, &gorm.Config{})
 	})
 	return db, err
 }
@@ -72,26 +106,45 @@ func AddMedia(media Media) error {
 	return nil
 }
 
-// FindMedia searches the database for Media items matching the title in query and returns the number of results
-// specified by limit.
-func FindMedia(query string, limit int, page int) ([]Media, uint) {
+// DeleteMedia removes a Media item from the database along with the records of its files, plays and segments. The
+// files themselves are left alone.
+func DeleteMedia(media Media) error {
 	db, err := GetDatabase()
 	if err != nil {
-		logrus.Fatal("Error loading database:", err)
+		return err
 	}
-	if page == 0 {
-		page = 1
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&MediaFile{}, &Play{}, &Segment{}} {
+			err := tx.Where("media_id = ? AND media_type = ?", media.ID, media.Type).Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+		// Deleting by the composite primary key generates a row value IN clause, which SQLite doesn't support.
+		return tx.Where("id = ? AND type = ?", media.ID, media.Type).Delete(&Media{}).Error
+	})
+}
+
+// IndexStats represents the state of the search index after rebuilding it.
+type IndexStats struct {
+	Indexed int64 `json:"indexed"`
+	Media   int64 `json:"media"`
+}
+
+// RebuildIndex rebuilds the search index from scratch from the media table.
+func RebuildIndex() (IndexStats, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return IndexStats{}, err
 	}
-	tokens := strings.Split(query, " ")
-	for i, token := range tokens {
-		tokens[i] = fmt.Sprintf("\"%v\"*", strings.Replace(token, "\"", "\"\"", -1))
+	var stats IndexStats
+	if stats.Indexed, err = getSearchIndex(db).rebuild(db); err != nil {
+		return IndexStats{}, err
 	}
-	subquery := db.Select("ROWID").Table("media_fts(?)", strings.Join(tokens, " ")).Order("rank")
-	var media []Media
-	db.Limit(limit).Offset((page - 1) * limit).Where("ROWID IN (?) AND type <> ?", subquery, "internal").Find(&media)
-	var count int64
-	db.Model(&Media{}).Where("ROWID IN (?) AND type <> ?", subquery, "internal").Count(&count)
-	return media, uint(math.Ceil(float64(count) / float64(limit)))
+	if err := db.Model(&Media{}).Count(&stats.Media).Error; err != nil {
+		return IndexStats{}, err
+	}
+	return stats, nil
 }
 
 // GetMedia attempts to return the Media identified by id and kind, and returns an error if not found.
@@ -122,6 +175,42 @@ func GetMediaByURL(url string) (Media, error) {
 	return Media{}, errors.New(fmt.Sprintf("media with url %v not found in database", url))
 }
 
+// GetMediaByType returns all Media of the given type.
+func GetMediaByType(kind string) ([]Media, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, err
+	}
+	var media []Media
+	err = db.Where(Media{Type: kind}).Find(&media).Error
+	return media, err
+}
+
+// GetRemoteMedia returns all Media that was downloaded from a URL, as opposed to local or internal Media.
+func GetRemoteMedia() ([]Media, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, err
+	}
+	var media []Media
+	err = db.Where("type NOT IN ?", localTypes).Find(&media).Error
+	return media, err
+}
+
+// GetMediaWithoutMetadata returns downloaded Media that is missing extended metadata such as the uploader and
+// thumbnail, skipping Media that metadata was already looked up for.
+func GetMediaWithoutMetadata() ([]Media, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, err
+	}
+	var media []Media
+	// Columns added to existing databases are NULL rather than empty.
+	err = db.Where("COALESCE(uploader, '') = '' AND COALESCE(thumbnail, '') = '' AND metadata_checked_at IS NULL "+
+		"AND type NOT IN ?", localTypes).Find(&media).Error
+	return media, err
+}
+
 // GetRandomMedia returns a number of random Media specified by limit.
 func GetRandomMedia(limit int) []Media {
 	db, err := GetDatabase()
@@ -129,6 +218,6 @@ func GetRandomMedia(limit int) []Media {
 		logrus.Fatal("Error loading database:", err)
 	}
 	var media []Media
-	db.Order("random()").Where("type <> ?", "internal").Limit(limit).Find(&media)
+	db.Order("random()").Where("type <> ?", "internal").Scopes(notBlocked).Limit(limit).Find(&media)
 	return media
 }
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"strings"
 	"time"
 )
 
@@ -12,13 +14,31 @@ type Media struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 
-	Length uint64 `gorm:"not null"`
-	Title  string `gorm:"not null"`
-	Type   string `gorm:"primary_key"`
-	Video  bool   `gorm:"not null"`
-	URL    string `gorm:"not null"`
+	Album       string
+	Artist      string
+	Description string
+	// EndTime is where playback stops by default, in the same units as Length. 0 plays until the end.
+	EndTime uint64 `gorm:"not null"`
+	Length  uint64 `gorm:"not null"`
+	// MetadataCheckedAt is when extended metadata was backfilled for the Media, whether or not any was found.
+	MetadataCheckedAt *time.Time
+	// Overrides is a comma-separated list of fields that were set manually and are left alone when refreshing.
+	Overrides string
+	// StartTime is where playback begins by default, in the same units as Length.
+	StartTime uint64 `gorm:"not null"`
+	// Stream is set for livestreams and radio streams, which are played directly from their source instead of being
+	// downloaded. Their Length is the maximum time they are played for.
+	Stream     bool `gorm:"not null"`
+	Thumbnail  string
+	Title      string `gorm:"not null"`
+	Type       string `gorm:"primary_key"`
+	UploadDate *time.Time
+	Uploader   string
+	Video      bool   `gorm:"not null"`
+	URL        string `gorm:"not null"`
 }
 
+// Save stores the current state of the Media in the database.
 func (m Media) Save() {
 	db, err := GetDatabase()
 	if err != nil {
@@ -26,3 +46,111 @@ func (m Media) Save() {
 	}
 	db.Save(&m)
 }
+
+// ValidateTrim checks that playback of the Media can be limited to between start and end, where an end of 0 plays
+// until the end.
+func (m Media) ValidateTrim(start uint64, end uint64) error {
+	if (start > 0 || end > 0) && m.Stream {
+		return errors.New("streams cannot be trimmed")
+	}
+	if end > 0 && start >= end {
+		return errors.New("start time must be before end time")
+	}
+	if start >= m.Length && start > 0 {
+		return errors.New("start time must be before the end of the media")
+	}
+	return nil
+}
+
+// IsLocal returns whether or not the Media is stored locally rather than downloaded from a URL, so that there is no
+// source to refresh its info from.
+func (m Media) IsLocal() bool {
+	for _, localType := range localTypes {
+		if m.Type == localType {
+			return true
+		}
+	}
+	return false
+}
+
+// Trimmed returns how long the Media plays for when limited to between start and end, in the same units as Length.
+func (m Media) Trimmed(start uint64, end uint64) uint64 {
+	if end == 0 || end > m.Length {
+		end = m.Length
+	}
+	if start >= end {
+		return 0
+	}
+	return end - start
+}
+
+// overridable returns the fields of the Media that can be overridden manually, keyed by their names.
+func (m *Media) overridable() map[string]*string {
+	return map[string]*string{
+		"album":       &m.Album,
+		"artist":      &m.Artist,
+		"description": &m.Description,
+		"title":       &m.Title,
+		"uploader":    &m.Uploader,
+	}
+}
+
+// IsOverridden returns whether or not the field with the given name was set manually.
+func (m Media) IsOverridden(field string) bool {
+	for _, override := range strings.Split(m.Overrides, ",") {
+		if override == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Override manually sets the field with the given name, protecting it from being replaced when refreshing.
+func (m *Media) Override(field string, value string) error {
+	target, ok := m.overridable()[field]
+	if !ok {
+		return errors.Errorf("field %v cannot be overridden", field)
+	}
+	if field == "title" && value == "" {
+		return errors.New("title cannot be empty")
+	}
+	*target = value
+	if !m.IsOverridden(field) {
+		overrides := append(m.overrides(), field)
+		m.Overrides = strings.Join(overrides, ",")
+	}
+	return nil
+}
+
+// ClearOverride allows the field with the given name to be replaced when refreshing again. The current value is kept
+// until then.
+func (m *Media) ClearOverride(field string) {
+	overrides := make([]string, 0)
+	for _, override := range m.overrides() {
+		if override != field {
+			overrides = append(overrides, override)
+		}
+	}
+	m.Overrides = strings.Join(overrides, ",")
+}
+
+// UpdateMetadata copies the extended metadata of fetched, usually freshly retrieved from the source, into the Media.
+// Fields that were overridden are left alone.
+func (m *Media) UpdateMetadata(fetched Media) {
+	fields := fetched.overridable()
+	for name, target := range m.overridable() {
+		if name != "title" && !m.IsOverridden(name) {
+			*target = *fields[name]
+		}
+	}
+	m.Thumbnail = fetched.Thumbnail
+	m.UploadDate = fetched.UploadDate
+}
+
+// overrides returns the names of the overridden fields of the Media.
+func (m Media) overrides() []string {
+	if m.Overrides == "" {
+		return make([]string, 0)
+	}
+	return strings.Split(m.Overrides, ",")
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"time"
+)
+
+// MediaFile represents a file stored on disk for a Media item. A single Media item can have multiple MediaFiles, such
+// as audio and video variants or files produced by different transcoding profiles.
+type MediaFile struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	AudioCodec string
+	Checksum   string `gorm:"not null"`
+	Container  string `gorm:"not null"`
+	MediaID    string `gorm:"not null;index:idx_media_files_media"`
+	MediaType  string `gorm:"not null;index:idx_media_files_media"`
+	// Path is relative to the data directory so that it can be moved without invalidating records.
+	Path       string `gorm:"not null;uniqueIndex"`
+	Profile    string
+	Size       int64 `gorm:"not null"`
+	Video      bool  `gorm:"not null"`
+	VideoCodec string
+}
+
+// AddMediaFile records a new MediaFile, replacing any existing record for the same path.
+func AddMediaFile(file MediaFile) error {
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Where(MediaFile{Path: file.Path}).Assign(file).FirstOrCreate(&file).Error
+}
+
+// DeleteMediaFile removes the record of a MediaFile.
+func DeleteMediaFile(file MediaFile) error {
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Delete(&file).Error
+}
+
+// GetMediaFiles returns all recorded MediaFiles for the given Media, newest first.
+func GetMediaFiles(media Media) ([]MediaFile, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, err
+	}
+	var files []MediaFile
+	err = db.Where(MediaFile{MediaID: media.ID, MediaType: media.Type}).Order("created_at DESC").Find(&files).Error
+	return files, err
+}
@@ -0,0 +1,374 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+)
+
+// migration represents a versioned change to the database schema. Each database driver applies its own SQL
+// statements, followed by up for changes that depend on the current state of the database. Migrations are applied
+// only once, so existing migrations must never be modified or renumbered; add a new one instead.
+type migration struct {
+	version  uint
+	name     string
+	sqlite   []string
+	postgres []string
+	up       func(tx *gorm.DB) error
+}
+
+// statements returns the SQL statements to apply for the given database driver.
+func (m migration) statements(driver string) []string {
+	if driver == DRIVER_POSTGRES {
+		return m.postgres
+	}
+	return m.sqlite
+}
+
+// SchemaMigration represents a migration that has been applied to the database.
+type SchemaMigration struct {
+	Version   uint      `gorm:"primary_key;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// MigrationStatus represents whether or not a migration has been applied to the database.
+type MigrationStatus struct {
+	Version   uint
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrations are applied in the order that they're listed. The search index was the first migration, but the tables
+// that it depends on were only tracked afterwards, so they're listed ahead of it. Tables are created with IF NOT
+// EXISTS since databases from before migrations were tracked already have them.
+var migrations = []migration{
+	{
+		version: 2,
+		name:    "create media table",
+		sqlite: []string{
+			"CREATE TABLE IF NOT EXISTS `media` (`id` text,`created_at` datetime,`updated_at` datetime," +
+				"`length` integer NOT NULL,`title` text NOT NULL,`type` text,`video` numeric NOT NULL," +
+				"`url` text NOT NULL,PRIMARY KEY (`id`,`type`));",
+		},
+		postgres: []string{
+			"CREATE TABLE IF NOT EXISTS media (id text,created_at timestamptz,updated_at timestamptz," +
+				"length bigint NOT NULL,title text NOT NULL,type text,video boolean NOT NULL,url text NOT NULL," +
+				"PRIMARY KEY (id,type));",
+		},
+	},
+	{
+		version: 3,
+		name:    "add media metadata columns",
+		postgres: []string{
+			"ALTER TABLE media ADD COLUMN IF NOT EXISTS album text,ADD COLUMN IF NOT EXISTS artist text," +
+				"ADD COLUMN IF NOT EXISTS description text,ADD COLUMN IF NOT EXISTS thumbnail text," +
+				"ADD COLUMN IF NOT EXISTS upload_date timestamptz,ADD COLUMN IF NOT EXISTS uploader text;",
+		},
+		// SQLite has no ADD COLUMN IF NOT EXISTS, so the columns that are missing have to be looked up.
+		up: func(tx *gorm.DB) error {
+			if tx.Dialector.Name() != DRIVER_SQLITE {
+				return nil
+			}
+			columns := []struct {
+				name string
+				kind string
+			}{
+				{"album", "text"},
+				{"artist", "text"},
+				{"description", "text"},
+				{"thumbnail", "text"},
+				{"upload_date", "datetime"},
+				{"uploader", "text"},
+			}
+			for _, column := range columns {
+				if tx.Migrator().HasColumn("media", column.name) {
+					continue
+				}
+				statement := fmt.Sprintf("ALTER TABLE `media` ADD COLUMN `%v` %v;", column.name, column.kind)
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 4,
+		name:    "create media_files table",
+		sqlite: []string{
+			"CREATE TABLE IF NOT EXISTS `media_files` (`id` integer,`created_at` datetime,`updated_at` datetime," +
+				"`audio_codec` text,`checksum` text NOT NULL,`container` text NOT NULL,`media_id` text NOT NULL," +
+				"`media_type` text NOT NULL,`path` text NOT NULL,`profile` text,`size` integer NOT NULL," +
+				"`video` numeric NOT NULL,`video_codec` text,PRIMARY KEY (`id`));",
+			"CREATE UNIQUE INDEX IF NOT EXISTS `idx_media_files_path` ON `media_files`(`path`);",
+			"CREATE INDEX IF NOT EXISTS `idx_media_files_media` ON `media_files`(`media_id`,`media_type`);",
+		},
+		postgres: []string{
+			"CREATE TABLE IF NOT EXISTS media_files (id bigserial,created_at timestamptz,updated_at timestamptz," +
+				"audio_codec text,checksum text NOT NULL,container text NOT NULL,media_id text NOT NULL," +
+				"media_type text NOT NULL,path text NOT NULL,profile text,size bigint NOT NULL," +
+				"video boolean NOT NULL,video_codec text,PRIMARY KEY (id));",
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_media_files_path ON media_files(path);",
+			"CREATE INDEX IF NOT EXISTS idx_media_files_media ON media_files(media_id,media_type);",
+		},
+	},
+	{
+		version: 5,
+		name:    "create plays table",
+		sqlite: []string{
+			"CREATE TABLE IF NOT EXISTS `plays` (`id` integer,`created_at` datetime,`length` integer NOT NULL," +
+				"`media_id` text NOT NULL,`media_type` text NOT NULL,`owner` integer NOT NULL,PRIMARY KEY (`id`));",
+			"CREATE INDEX IF NOT EXISTS `idx_plays_media` ON `plays`(`media_id`,`media_type`);",
+		},
+		postgres: []string{
+			"CREATE TABLE IF NOT EXISTS plays (id bigserial,created_at timestamptz,length bigint NOT NULL," +
+				"media_id text NOT NULL,media_type text NOT NULL,owner bigint NOT NULL,PRIMARY KEY (id));",
+			"CREATE INDEX IF NOT EXISTS idx_plays_media ON plays(media_id,media_type);",
+		},
+	},
+	{
+		version: 1,
+		name:    "create media search index",
+		// Older databases may already have a search index that lacks artists or whose update trigger was never
+		// created because it shared its name with the insert trigger, so everything is recreated from scratch.
+		sqlite: []string{
+			"DROP TRIGGER IF EXISTS media_fts_insert;",
+			"DROP TRIGGER IF EXISTS media_fts_delete;",
+			"DROP TRIGGER IF EXISTS media_fts_update;",
+			"DROP TABLE IF EXISTS media_fts;",
+			"CREATE VIRTUAL TABLE media_fts USING fts5(title, artist, content=media, tokenize='porter trigram');",
+			"CREATE TRIGGER media_fts_insert AFTER INSERT ON media BEGIN " +
+				"INSERT INTO media_fts (rowid, title, artist) VALUES (new.rowid, new.title, new.artist); END;",
+			"CREATE TRIGGER media_fts_delete AFTER DELETE ON media BEGIN " +
+				"INSERT INTO media_fts (media_fts, rowid, title, artist) VALUES " +
+				"('delete', old.rowid, old.title, old.artist); END;",
+			"CREATE TRIGGER media_fts_update AFTER UPDATE ON media BEGIN " +
+				"INSERT INTO media_fts (media_fts, rowid, title, artist) VALUES " +
+				"('delete', old.rowid, old.title, old.artist);" +
+				"INSERT INTO media_fts (rowid, title, artist) VALUES (new.rowid, new.title, new.artist); END;",
+			"INSERT INTO media_fts (media_fts) VALUES ('rebuild');",
+		},
+		// The generated column keeps itself up to date, while the trigram indexes speed up the substring matches
+		// that the SQLite trigram tokenizer provides.
+		postgres: []string{
+			"CREATE EXTENSION IF NOT EXISTS pg_trgm;",
+			"ALTER TABLE media ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (" +
+				"setweight(to_tsvector('english', coalesce(title, '')), 'A') || " +
+				"setweight(to_tsvector('english', coalesce(artist, '')), 'B')) STORED;",
+			"CREATE INDEX IF NOT EXISTS idx_media_search ON media USING GIN (search);",
+			"CREATE INDEX IF NOT EXISTS idx_media_title_trgm ON media USING GIN (title gin_trgm_ops);",
+			"CREATE INDEX IF NOT EXISTS idx_media_artist_trgm ON media USING GIN (artist gin_trgm_ops);",
+		},
+	},
+	{
+		version:  6,
+		name:     "add media overrides column",
+		sqlite:   []string{"ALTER TABLE `media` ADD COLUMN `overrides` text;"},
+		postgres: []string{"ALTER TABLE media ADD COLUMN IF NOT EXISTS overrides text;"},
+	},
+	{
+		version: 7,
+		name:    "create blocks table",
+		sqlite: []string{
+			"CREATE TABLE IF NOT EXISTS `blocks` (`id` integer,`created_at` datetime,`kind` text NOT NULL," +
+				"`pattern` text NOT NULL,`reason` text,PRIMARY KEY (`id`));",
+		},
+		postgres: []string{
+			"CREATE TABLE IF NOT EXISTS blocks (id bigserial,created_at timestamptz,kind text NOT NULL," +
+				"pattern text NOT NULL,reason text,PRIMARY KEY (id));",
+		},
+	},
+	{
+		version:  8,
+		name:     "add media stream column",
+		sqlite:   []string{"ALTER TABLE `media` ADD COLUMN `stream` numeric NOT NULL DEFAULT false;"},
+		postgres: []string{"ALTER TABLE media ADD COLUMN IF NOT EXISTS stream boolean NOT NULL DEFAULT false;"},
+	},
+	{
+		version: 9,
+		name:    "add media trim columns",
+		sqlite: []string{
+			"ALTER TABLE `media` ADD COLUMN `start_time` integer NOT NULL DEFAULT 0;",
+			"ALTER TABLE `media` ADD COLUMN `end_time` integer NOT NULL DEFAULT 0;",
+		},
+		postgres: []string{
+			"ALTER TABLE media ADD COLUMN IF NOT EXISTS start_time bigint NOT NULL DEFAULT 0;",
+			"ALTER TABLE media ADD COLUMN IF NOT EXISTS end_time bigint NOT NULL DEFAULT 0;",
+		},
+	},
+	{
+		version: 10,
+		name:    "create segments table",
+		sqlite: []string{
+			"CREATE TABLE IF NOT EXISTS `segments` (`id` integer,`created_at` datetime,`category` text NOT NULL," +
+				"`end_time` integer NOT NULL,`media_id` text NOT NULL,`media_type` text NOT NULL," +
+				"`start_time` integer NOT NULL,`uuid` text,PRIMARY KEY (`id`));",
+			"CREATE INDEX IF NOT EXISTS `idx_segments_media` ON `segments`(`media_id`,`media_type`);",
+		},
+		postgres: []string{
+			"CREATE TABLE IF NOT EXISTS segments (id bigserial,created_at timestamptz,category text NOT NULL," +
+				"end_time bigint NOT NULL,media_id text NOT NULL,media_type text NOT NULL," +
+				"start_time bigint NOT NULL,uuid text,PRIMARY KEY (id));",
+			"CREATE INDEX IF NOT EXISTS idx_segments_media ON segments(media_id,media_type);",
+		},
+	},
+	{
+		version: 11,
+		name:    "create schedules table",
+		sqlite: []string{
+			"CREATE TABLE IF NOT EXISTS `schedules` (`id` integer,`created_at` datetime,`action` text NOT NULL," +
+				"`cron` text NOT NULL,`enabled` numeric NOT NULL,`media_id` text,`media_type` text,`name` text," +
+				"`volume` integer,PRIMARY KEY (`id`));",
+		},
+		postgres: []string{
+			"CREATE TABLE IF NOT EXISTS schedules (id bigserial,created_at timestamptz,action text NOT NULL," +
+				"cron text NOT NULL,enabled boolean NOT NULL,media_id text,media_type text,name text,volume bigint," +
+				"PRIMARY KEY (id));",
+		},
+	},
+	{
+		version:  12,
+		name:     "add media metadata checked column",
+		sqlite:   []string{"ALTER TABLE `media` ADD COLUMN `metadata_checked_at` datetime;"},
+		postgres: []string{"ALTER TABLE media ADD COLUMN IF NOT EXISTS metadata_checked_at timestamptz;"},
+	},
+}
+
+// Migrate applies all migrations that haven't been applied to the database yet, backing up the database first.
+func Migrate() error {
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	driver := db.Dialector.Name()
+	if err := backup(db); err != nil {
+		return fmt.Errorf("could not back up database before migrating: %v", err)
+	}
+	for _, migration := range pending {
+		logrus.Infof("applying database migration %v: %v", migration.version, migration.name)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, statement := range migration.statements(driver) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			if migration.up != nil {
+				if err := migration.up(tx); err != nil {
+					return err
+				}
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.version,
+				Name:      migration.name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("could not apply database migration %v: %v", migration.version, err)
+		}
+	}
+	return nil
+}
+
+// GetMigrationStatus returns every known migration along with when it was applied, if it has been.
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	db, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0)
+	for _, migration := range migrations {
+		status := MigrationStatus{
+			Version: migration.version,
+			Name:    migration.name,
+		}
+		if appliedMigration, ok := applied[migration.version]; ok {
+			status.AppliedAt = &appliedMigration.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// appliedMigrations returns the migrations that have been applied to the database, keyed by version.
+func appliedMigrations(db *gorm.DB) (map[uint]SchemaMigration, error) {
+	statement := "CREATE TABLE IF NOT EXISTS `schema_migrations` (`version` integer,`name` text NOT NULL," +
+		"`applied_at` datetime NOT NULL,PRIMARY KEY (`version`));"
+	if db.Dialector.Name() == DRIVER_POSTGRES {
+		statement = "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint,name text NOT NULL," +
+			"applied_at timestamptz NOT NULL,PRIMARY KEY (version));"
+	}
+	if err := db.Exec(statement).Error; err != nil {
+		return nil, err
+	}
+	var rows []SchemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]SchemaMigration)
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// pendingMigrations returns the migrations that haven't been applied to the database yet, in order.
+func pendingMigrations(db *gorm.DB) ([]migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]migration, 0)
+	for _, migration := range migrations {
+		if _, ok := applied[migration.version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// backup writes a consistent copy of the database to the backups directory. Fresh databases are not backed up, and
+// neither are PostgreSQL databases, which are better served by pg_dump.
+func backup(db *gorm.DB) error {
+	if db.Dialector.Name() != DRIVER_SQLITE {
+		logrus.Infof("not backing up %v database before migrating", db.Dialector.Name())
+		return nil
+	}
+	var tables int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'media';").
+		Scan(&tables).Error; err != nil {
+		return err
+	}
+	if tables == 0 {
+		return nil
+	}
+	backupDir := path.Join(viper.GetString(constants.DATA), "backups")
+	if err := os.MkdirAll(backupDir, os.ModeDir|0755); err != nil {
+		return err
+	}
+	backupPath := path.Join(backupDir, fmt.Sprintf("prismriver-%v.db", time.Now().Format("20060102-150405")))
+	if err := db.Exec("VACUUM INTO ?;", backupPath).Error; err != nil {
+		return err
+	}
+	logrus.Infof("backed up database to %v", backupPath)
+	return nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"time"
+)
+
+// Play represents a single playback of a Media item, used to keep track of play history.
+type Play struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+
+	Length    uint64 `gorm:"not null"`
+	MediaID   string `gorm:"not null;index:idx_plays_media"`
+	MediaType string `gorm:"not null;index:idx_plays_media"`
+	Owner     uint32 `gorm:"not null"`
+}
+
+// PlayTotal represents how much an owner played within a period of time.
+type PlayTotal struct {
+	// Length is in the same units as Media.Length.
+	Length uint64
+	Owner  uint32
+	Plays  int64
+}
+
+// AddPlay records a new playback of the given Media by owner in the play history. length is how long the Media
+// actually played for, which is shorter than its Length if it was trimmed or skipped.
+func AddPlay(media Media, owner uint32, length uint64) error {
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Create(&Play{
+		Length:    length,
+		MediaID:   media.ID,
+		MediaType: media.Type,
+		Owner:     owner,
+	}).Error
+}
+
+// GetPopularMedia returns the most frequently played Media in the play history, up to the number specified by limit.
+func GetPopularMedia(limit int) ([]Media, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, err
+	}
+	var media []Media
+	err = db.Model(&Media{}).Select("media.*").
+		Joins("JOIN plays ON plays.media_id = media.id AND plays.media_type = media.type").
+		Where("media.type <> ?", "internal").
+		Scopes(notBlocked).
+		Group("media.id, media.type").
+		Order("COUNT(plays.id) DESC").
+		Limit(limit).
+		Find(&media).Error
+	return media, err
+}
+
+// GetPlayTotals returns how much each owner played since the given time.
+func GetPlayTotals(since time.Time) ([]PlayTotal, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, err
+	}
+	var totals []PlayTotal
+	err = db.Model(&Play{}).Select("owner, COUNT(*) AS plays, SUM(length) AS length").
+		Where("created_at >= ?", since).
+		Group("owner").
+		Scan(&totals).Error
+	return totals, err
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Actions that Schedules can take when they're due.
+const (
+	// SCHEDULE_BE_QUIET plays a Be Quiet announcement like the Be Quiet button does.
+	SCHEDULE_BE_QUIET = "be_quiet"
+	// SCHEDULE_CLEAR stops playback and removes everything from the Queue.
+	SCHEDULE_CLEAR = "clear"
+	// SCHEDULE_ENQUEUE adds a Media item to the top of the Queue, right after whatever is currently playing.
+	SCHEDULE_ENQUEUE = "enqueue"
+	// SCHEDULE_PAUSE pauses whatever is currently playing.
+	SCHEDULE_PAUSE = "pause"
+	// SCHEDULE_RESUME resumes playback after SCHEDULE_PAUSE.
+	SCHEDULE_RESUME = "resume"
+	// SCHEDULE_STOP stops playback by pausing whatever is currently playing or loading, if anything is. The Queue is
+	// left as it is, so SCHEDULE_RESUME picks up where it left off.
+	SCHEDULE_STOP = "stop"
+	// SCHEDULE_VOLUME sets the volume of the Player.
+	SCHEDULE_VOLUME = "volume"
+)
+
+// Schedule represents an action that is taken automatically whenever its cron expression is due.
+type Schedule struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Action  string `gorm:"not null" json:"action"`
+	Cron    string `gorm:"not null" json:"cron"`
+	Enabled bool   `gorm:"not null" json:"enabled"`
+	// MediaID and MediaType identify the Media item to add for SCHEDULE_ENQUEUE. For SCHEDULE_BE_QUIET, MediaID
+	// optionally picks the internal Media to announce instead of db.BeQuiet.
+	MediaID   string `json:"media_id"`
+	MediaType string `json:"media_type"`
+	Name      string `json:"name"`
+	// Volume is the volume to set for SCHEDULE_VOLUME, from 0 to 100.
+	Volume int `json:"volume"`
+}
+
+// Validate returns an error if the Schedule has an unknown action or is missing what its action needs. The cron
+// expression is checked by the scheduler, which knows how to parse it.
+func (s Schedule) Validate() error {
+	if s.Cron == "" {
+		return errors.New("schedule cron expression cannot be empty")
+	}
+	switch s.Action {
+	case SCHEDULE_ENQUEUE:
+		if s.MediaID == "" || s.MediaType == "" {
+			return errors.New("enqueue schedule must have a media item")
+		}
+	case SCHEDULE_VOLUME:
+		if s.Volume < 0 || s.Volume > 100 {
+			return errors.Errorf("schedule volume %v is outside of 0-100", s.Volume)
+		}
+	case SCHEDULE_BE_QUIET, SCHEDULE_CLEAR, SCHEDULE_PAUSE, SCHEDULE_RESUME, SCHEDULE_STOP:
+	default:
+		return errors.Errorf("unknown schedule action %v", s.Action)
+	}
+	return nil
+}
+
+// AddSchedule validates and stores a new Schedule, filling in its ID.
+func AddSchedule(schedule *Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Create(schedule).Error
+}
+
+// UpdateSchedule validates and stores changes to an existing Schedule.
+func UpdateSchedule(schedule Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Save(&schedule).Error
+}
+
+// DeleteSchedule removes a Schedule so that it's no longer run.
+func DeleteSchedule(schedule Schedule) error {
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Delete(&schedule).Error
+}
+
+// GetSchedule attempts to return the Schedule identified by id, and returns an error if not found.
+func GetSchedule(id uint) (Schedule, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return Schedule{}, err
+	}
+	var schedule Schedule
+	err = db.First(&schedule, id).Error
+	return schedule, err
+}
+
+// GetSchedules returns every Schedule in the order that they were added. If enabled is true, only enabled Schedules
+// are returned.
+func GetSchedules(enabled bool) ([]Schedule, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, err
+	}
+	tx := db.Order("id")
+	if enabled {
+		tx = tx.Where("enabled = ?", true)
+	}
+	var schedules []Schedule
+	err = tx.Find(&schedules).Error
+	return schedules, err
+}
@@ -0,0 +1,332 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sort orders available for searching Media.
+const (
+	// SORT_RANK orders results by how well they match the query.
+	SORT_RANK = "rank"
+	// SORT_RECENT orders results by when they were added, newest first.
+	SORT_RECENT = "recent"
+	// SORT_PLAYS orders results by how often they were played, most played first.
+	SORT_PLAYS = "plays"
+	// SORT_TITLE orders results alphabetically by title.
+	SORT_TITLE = "title"
+)
+
+// SearchOptions represents the filters, sort order and pagination used for searching Media.
+type SearchOptions struct {
+	// Query is matched against titles and artists. Quoted phrases are matched exactly, words prefixed with - are
+	// excluded, and all other words are matched as prefixes.
+	Query string
+	// Type limits results to Media of a single type if set.
+	Type string
+	// Video limits results to Media with or without video if set.
+	Video *bool
+	// MinLength and MaxLength limit results to Media within a length range, in the same units as Media.Length. 0
+	// disables the respective bound.
+	MinLength uint64
+	MaxLength uint64
+	// AddedSince limits results to Media added after the given time if set.
+	AddedSince time.Time
+	// Sort is one of the SORT_* constants. Defaults to SORT_RANK for queries and SORT_RECENT otherwise.
+	Sort string
+	// Limit is the maximum number of results to return.
+	Limit int
+	// Page is the 1-indexed page of results to return. Ignored if Cursor is set.
+	Page int
+	// Cursor continues a previous search from where it left off.
+	Cursor string
+}
+
+// SearchResult represents a single page of results from searching Media.
+type SearchResult struct {
+	Media []Media
+	// NextCursor can be passed as SearchOptions.Cursor to retrieve the next page, and is empty on the last page.
+	NextCursor string
+	Pages      uint
+	Total      int64
+}
+
+// FindMedia searches the database for Media items matching the given options.
+func FindMedia(options SearchOptions) (SearchResult, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return SearchResult{}, err
+	}
+	if options.Limit <= 0 {
+		return SearchResult{}, errors.New("search limit must be positive")
+	}
+
+	index := getSearchIndex(db)
+	include, exclude := parseQuery(options.Query)
+	sort := options.Sort
+	if sort == "" || sort == SORT_RANK && len(include) == 0 {
+		sort = SORT_RECENT
+		if len(include) > 0 {
+			sort = SORT_RANK
+		}
+	}
+	var order sortOrder
+	joins := func(tx *gorm.DB) *gorm.DB {
+		return tx
+	}
+	switch sort {
+	case SORT_RANK:
+		order = index.rank(include)
+	case SORT_PLAYS:
+		order = sortOrder{key: "COALESCE(play_counts.count, 0)", descending: true}
+		joins = func(tx *gorm.DB) *gorm.DB {
+			return tx.Joins("LEFT JOIN (SELECT media_id, media_type, COUNT(*) AS count FROM plays " +
+				"GROUP BY media_id, media_type) AS play_counts " +
+				"ON play_counts.media_id = media.id AND play_counts.media_type = media.type")
+		}
+	case SORT_RECENT:
+		order = sortOrder{key: "media.created_at", descending: true}
+	case SORT_TITLE:
+		order = sortOrder{key: "LOWER(media.title)"}
+	default:
+		return SearchResult{}, errors.Errorf("unknown sort order %v", sort)
+	}
+
+	filter := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Where("media.type <> ?", "internal").Scopes(notBlocked)
+		if len(include) > 0 {
+			tx = index.match(tx, include)
+		}
+		if len(exclude) > 0 {
+			tx = index.exclude(tx, exclude)
+		}
+		if options.Type != "" {
+			tx = tx.Where("media.type = ?", options.Type)
+		}
+		if options.Video != nil {
+			tx = tx.Where("media.video = ?", *options.Video)
+		}
+		if options.MinLength > 0 {
+			tx = tx.Where("media.length >= ?", options.MinLength)
+		}
+		if options.MaxLength > 0 {
+			tx = tx.Where("media.length <= ?", options.MaxLength)
+		}
+		if !options.AddedSince.IsZero() {
+			tx = tx.Where("media.created_at >= ?", options.AddedSince)
+		}
+		return tx
+	}
+
+	query := db.Model(&Media{}).Select("media.*").Scopes(filter, joins)
+	count := db.Model(&Media{}).Scopes(filter)
+	direction := ""
+	if order.descending {
+		direction = " DESC"
+	}
+	// Keep the order stable between pages for Media that compare equal. An ordering expression replaces any
+	// columns ordered by, so they're all part of the same one.
+	query = query.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:                order.key + direction + ", media.type, media.id",
+		Vars:               order.args,
+		WithoutParentheses: true,
+	}})
+	if options.Cursor != "" {
+		cursor, err := decodeCursor(options.Cursor, sort)
+		if err != nil {
+			return SearchResult{}, err
+		}
+		query = order.after(query, cursor)
+	} else if options.Page > 1 {
+		query = query.Offset((options.Page - 1) * options.Limit)
+	}
+
+	var result SearchResult
+	if err := count.Count(&result.Total).Error; err != nil {
+		return SearchResult{}, err
+	}
+	// One more than the limit is requested to find out whether or not there is a next page.
+	if err := query.Limit(options.Limit + 1).Find(&result.Media).Error; err != nil {
+		return SearchResult{}, err
+	}
+	result.Pages = uint(math.Ceil(float64(result.Total) / float64(options.Limit)))
+	if len(result.Media) > options.Limit {
+		result.Media = result.Media[:options.Limit]
+		last := result.Media[len(result.Media)-1]
+		key := sortKey(sort)
+		err := db.Model(&Media{}).Scopes(filter, joins).Where("media.id = ? AND media.type = ?", last.ID, last.Type).
+			Select(order.key, order.args...).Row().Scan(key)
+		if err != nil {
+			return SearchResult{}, err
+		}
+		if result.NextCursor, err = encodeCursor(searchCursor{Key: key, Type: last.Type, ID: last.ID}); err != nil {
+			return SearchResult{}, err
+		}
+	}
+	return result, nil
+}
+
+// sortOrder represents how search results are ordered. Media that compare equal are further ordered by type and ID.
+type sortOrder struct {
+	// key is the SQL expression that results are ordered by, with args as its arguments.
+	key        string
+	args       []interface{}
+	descending bool
+}
+
+// after limits tx to the results that come after the one that cursor points at.
+func (o sortOrder) after(tx *gorm.DB, cursor searchCursor) *gorm.DB {
+	operator := ">"
+	if o.descending {
+		operator = "<"
+	}
+	condition := fmt.Sprintf("(%[1]v %[2]v ? OR %[1]v = ? AND (media.type > ? OR media.type = ? AND media.id > ?))",
+		o.key, operator)
+	args := make([]interface{}, 0)
+	for i := 0; i < 2; i++ {
+		args = append(args, o.args...)
+		args = append(args, cursor.value())
+	}
+	args = append(args, cursor.Type, cursor.Type, cursor.ID)
+	return tx.Where(condition, args...)
+}
+
+// searchCursor represents the last result of a page of search results, so that the next page can continue after it.
+type searchCursor struct {
+	// Key is a pointer to the value of the sortOrder key for the result, whose type depends on the sort order.
+	Key  interface{} `json:"key"`
+	Type string      `json:"type"`
+	ID   string      `json:"id"`
+}
+
+// value returns the sort key of the cursor without the pointer around it.
+func (c searchCursor) value() interface{} {
+	switch key := c.Key.(type) {
+	case *float64:
+		return *key
+	case *int64:
+		return *key
+	case *time.Time:
+		return *key
+	case *string:
+		return *key
+	}
+	return c.Key
+}
+
+// sortKey returns a pointer to the type that the sort key of the given sort order is read into.
+func sortKey(sort string) interface{} {
+	switch sort {
+	case SORT_RANK:
+		return new(float64)
+	case SORT_PLAYS:
+		return new(int64)
+	case SORT_RECENT:
+		return new(time.Time)
+	}
+	return new(string)
+}
+
+// searchTerm represents a single word or quoted phrase in a search query.
+type searchTerm struct {
+	text   string
+	phrase bool
+}
+
+// searchIndex implements full text search of Media for a database driver.
+type searchIndex interface {
+	// match limits tx to Media matching all of the given terms.
+	match(tx *gorm.DB, terms []searchTerm) *gorm.DB
+	// exclude limits tx to Media matching none of the given terms.
+	exclude(tx *gorm.DB, terms []searchTerm) *gorm.DB
+	// rank returns the sortOrder for how well Media match the given terms, best match first. Results have already
+	// been passed to match.
+	rank(terms []searchTerm) sortOrder
+	// rebuild rebuilds the index from scratch and returns the number of indexed Media.
+	rebuild(db *gorm.DB) (int64, error)
+}
+
+// getSearchIndex returns the searchIndex for the driver used by db.
+func getSearchIndex(db *gorm.DB) searchIndex {
+	if db.Dialector.Name() == DRIVER_POSTGRES {
+		return postgresIndex{}
+	}
+	return sqliteIndex{}
+}
+
+// parseQuery splits a search query into terms that Media must and must not match. Quoted phrases are matched exactly,
+// words prefixed with - are excluded, and all other words are matched as prefixes.
+func parseQuery(query string) ([]searchTerm, []searchTerm) {
+	include := make([]searchTerm, 0)
+	exclude := make([]searchTerm, 0)
+	for len(query) > 0 {
+		query = strings.TrimLeft(query, " \t")
+		if len(query) == 0 {
+			break
+		}
+		negate := false
+		if query[0] == '-' {
+			negate = true
+			query = query[1:]
+		}
+		var term searchTerm
+		if len(query) > 0 && query[0] == '"' {
+			phrase := query[1:]
+			query = ""
+			if end := strings.IndexByte(phrase, '"'); end != -1 {
+				phrase, query = phrase[:end], phrase[end+1:]
+			}
+			if strings.TrimSpace(phrase) == "" {
+				continue
+			}
+			term = searchTerm{text: phrase, phrase: true}
+		} else {
+			end := strings.IndexAny(query, " \t")
+			if end == -1 {
+				end = len(query)
+			}
+			if query[:end] == "" {
+				continue
+			}
+			term = searchTerm{text: query[:end]}
+			query = query[end:]
+		}
+		if negate {
+			exclude = append(exclude, term)
+		} else {
+			include = append(include, term)
+		}
+	}
+	return include, exclude
+}
+
+// encodeCursor returns an opaque cursor pointing at the given search result.
+func encodeCursor(cursor searchCursor) (string, error) {
+	encoded, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// decodeCursor returns the search result that a cursor points at, which must have come from a search with the given
+// sort order.
+func decodeCursor(cursor string, sort string) (searchCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return searchCursor{}, errors.Wrap(err, "invalid cursor")
+	}
+	result := searchCursor{Key: sortKey(sort)}
+	if err := json.Unmarshal(decoded, &result); err != nil || result.Type == "" || result.ID == "" {
+		return searchCursor{}, errors.New("invalid cursor")
+	}
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// postgresIndex searches Media using the generated search column, falling back to substring matches backed by
+// trigram indexes so that partial words match like they do with the SQLite trigram tokenizer.
+type postgresIndex struct{}
+
+// termCondition is the condition for Media to match a single search term. Artists are coalesced so that the
+// condition is never NULL, which would also exclude Media from the negated condition.
+const termCondition = "(media.search @@ %v OR media.title ILIKE ? OR COALESCE(media.artist, '') ILIKE ?)"
+
+func (postgresIndex) match(tx *gorm.DB, terms []searchTerm) *gorm.DB {
+	for _, term := range terms {
+		condition, args := termSQL(term)
+		tx = tx.Where(condition, args...)
+	}
+	return tx
+}
+
+func (postgresIndex) exclude(tx *gorm.DB, terms []searchTerm) *gorm.DB {
+	for _, term := range terms {
+		condition, args := termSQL(term)
+		tx = tx.Not(condition, args...)
+	}
+	return tx
+}
+
+func (postgresIndex) rank(terms []searchTerm) sortOrder {
+	queries := make([]string, 0)
+	vars := make([]interface{}, 0)
+	for _, term := range terms {
+		query, value := tsquery(term)
+		queries = append(queries, query)
+		vars = append(vars, value)
+	}
+	return sortOrder{
+		key:        "ts_rank(media.search, " + strings.Join(queries, " && ") + ")",
+		args:       vars,
+		descending: true,
+	}
+}
+
+func (postgresIndex) rebuild(db *gorm.DB) (int64, error) {
+	// The search column is generated by the database and always current, so only the indexes need rebuilding.
+	for _, index := range []string{"idx_media_search", "idx_media_title_trgm", "idx_media_artist_trgm"} {
+		if err := db.Exec("REINDEX INDEX " + index + ";").Error; err != nil {
+			return 0, err
+		}
+	}
+	var indexed int64
+	err := db.Model(&Media{}).Where("search IS NOT NULL").Count(&indexed).Error
+	return indexed, err
+}
+
+// termSQL returns the condition and its arguments for Media to match a single search term.
+func termSQL(term searchTerm) (string, []interface{}) {
+	query, value := tsquery(term)
+	pattern := "%" + escapeLike(term.text) + "%"
+	return fmt.Sprintf(termCondition, query), []interface{}{value, pattern, pattern}
+}
+
+// tsquery returns the SQL for a text search query matching the given term along with its argument. Words are matched
+// as prefixes, with any characters that have meaning in a tsquery removed.
+func tsquery(term searchTerm) (string, string) {
+	if term.phrase {
+		return "phraseto_tsquery('english', ?)", term.text
+	}
+	word := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, term.text)
+	if word == "" {
+		// An empty query matches nothing, leaving the substring match to decide.
+		return "plainto_tsquery('english', ?)", ""
+	}
+	return "to_tsquery('english', ?)", word + ":*"
+}
+
+// escapeLike escapes the wildcard characters of a LIKE pattern so that text is matched literally.
+func escapeLike(text string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(text)
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// sqliteIndex searches Media using the media_fts FTS5 table.
+type sqliteIndex struct{}
+
+func (sqliteIndex) match(tx *gorm.DB, terms []searchTerm) *gorm.DB {
+	return tx.Joins("JOIN media_fts(?) AS fts ON fts.rowid = media.rowid", ftsExpression(terms, " "))
+}
+
+func (sqliteIndex) exclude(tx *gorm.DB, terms []searchTerm) *gorm.DB {
+	excluded := tx.Session(&gorm.Session{NewDB: true}).Table("media_fts(?)", ftsExpression(terms, " OR ")).
+		Select("rowid")
+	return tx.Where("media.rowid NOT IN (?)", excluded)
+}
+
+func (sqliteIndex) rank(terms []searchTerm) sortOrder {
+	return sortOrder{key: "fts.rank"}
+}
+
+func (sqliteIndex) rebuild(db *gorm.DB) (int64, error) {
+	if err := db.Exec("INSERT INTO media_fts (media_fts) VALUES ('rebuild');").Error; err != nil {
+		return 0, err
+	}
+	// The docsize shadow table holds a row for every document in the index.
+	var indexed int64
+	err := db.Table("media_fts_docsize").Count(&indexed).Error
+	return indexed, err
+}
+
+// ftsExpression converts search terms into an FTS5 expression, joining them with the given operator.
+func ftsExpression(terms []searchTerm, operator string) string {
+	expressions := make([]string, 0)
+	for _, term := range terms {
+		expression := quote(term.text)
+		if !term.phrase {
+			expression += "*"
+		}
+		expressions = append(expressions, expression)
+	}
+	return strings.Join(expressions, operator)
+}
+
+// quote escapes a term as an FTS5 string so that it is matched literally.
+func quote(term string) string {
+	return fmt.Sprintf("\"%v\"", strings.Replace(term, "\"", "\"\"", -1))
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SegmentCategories are the categories that Segments can have, which are the same as the ones used by SponsorBlock.
+var SegmentCategories = []string{"filler", "interaction", "intro", "music_offtopic", "outro", "preview", "selfpromo",
+	"sponsor"}
+
+// segmentImportBatch is how many Segments are inserted at once when importing.
+const segmentImportBatch = 500
+
+// Segment represents a part of a Media item that can be skipped during playback, such as a non-music intro.
+type Segment struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Category string `gorm:"not null" json:"category"`
+	// EndTime and StartTime are in the same units as Media.Length.
+	EndTime   uint64 `gorm:"not null" json:"end"`
+	MediaID   string `gorm:"not null;index:idx_segments_media" json:"media_id"`
+	MediaType string `gorm:"not null;index:idx_segments_media" json:"media_type"`
+	StartTime uint64 `gorm:"not null" json:"start"`
+	// UUID identifies Segments imported from SponsorBlock so that they aren't duplicated when importing again. It's
+	// empty for Segments that were added manually.
+	UUID string `json:"uuid"`
+}
+
+// Validate returns an error if the Segment has an unknown category or doesn't cover any time.
+func (s Segment) Validate() error {
+	if s.MediaID == "" || s.MediaType == "" {
+		return errors.New("segment must belong to a media item")
+	}
+	if s.StartTime >= s.EndTime {
+		return errors.New("segment must start before it ends")
+	}
+	for _, category := range SegmentCategories {
+		if s.Category == category {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown segment category %v", s.Category)
+}
+
+// AddSegment validates and stores a new Segment, filling in its ID.
+func AddSegment(segment *Segment) error {
+	if err := segment.Validate(); err != nil {
+		return err
+	}
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Create(segment).Error
+}
+
+// UpdateSegment validates and stores changes to an existing Segment.
+func UpdateSegment(segment Segment) error {
+	if err := segment.Validate(); err != nil {
+		return err
+	}
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Save(&segment).Error
+}
+
+// DeleteSegment removes a Segment so that it's played again.
+func DeleteSegment(segment Segment) error {
+	db, err := GetDatabase()
+	if err != nil {
+		return err
+	}
+	return db.Delete(&segment).Error
+}
+
+// GetSegment attempts to return the Segment identified by id, and returns an error if not found.
+func GetSegment(id uint) (Segment, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return Segment{}, err
+	}
+	var segment Segment
+	err = db.First(&segment, id).Error
+	return segment, err
+}
+
+// GetSegments returns the Segments of the given Media in order of their start times. If any categories are given,
+// only Segments in those categories are returned.
+func GetSegments(media Media, categories ...string) ([]Segment, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, err
+	}
+	tx := db.Where(Segment{MediaID: media.ID, MediaType: media.Type})
+	if len(categories) > 0 {
+		tx = tx.Where("category IN ?", categories)
+	}
+	var segments []Segment
+	err = tx.Order("start_time").Find(&segments).Error
+	return segments, err
+}
+
+// ImportSegments imports skip segments from a SponsorBlock sponsorTimes.csv database dump, returning how many were
+// added. Only segments for YouTube Media already in the database are imported, and segments that were downvoted,
+// hidden, or don't skip are ignored.
+func ImportSegments(dump io.Reader) (int, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	if err := db.Model(&Media{}).Where("type = ?", "youtube").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	known := make(map[string]bool)
+	for _, id := range ids {
+		known[id] = true
+	}
+	var uuids []string
+	if err := db.Model(&Segment{}).Where("uuid <> ''").Pluck("uuid", &uuids).Error; err != nil {
+		return 0, err
+	}
+	imported := make(map[string]bool)
+	for _, uuid := range uuids {
+		imported[uuid] = true
+	}
+
+	reader := csv.NewReader(dump)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not read segment dump header")
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"videoID", "startTime", "endTime", "category", "UUID"} {
+		if _, ok := columns[name]; !ok {
+			return 0, errors.Errorf("segment dump is missing column %v", name)
+		}
+	}
+	// Columns that aren't present in older dumps are treated as empty.
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	seconds := func(record []string, name string) (uint64, bool) {
+		value, err := strconv.ParseFloat(field(record, name), 64)
+		if err != nil || value < 0 {
+			return 0, false
+		}
+		return uint64(value * float64(time.Millisecond)), true
+	}
+
+	count := 0
+	batch := make([]Segment, 0, segmentImportBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := db.Create(&batch).Error; err != nil {
+			return err
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, errors.Wrap(err, "could not read segment dump")
+		}
+		uuid := field(record, "UUID")
+		if !known[field(record, "videoID")] || uuid == "" || imported[uuid] {
+			continue
+		}
+		if votes, err := strconv.Atoi(field(record, "votes")); err == nil && votes < 0 {
+			continue
+		}
+		if field(record, "hidden") == "1" || field(record, "shadowHidden") == "1" {
+			continue
+		}
+		if action := field(record, "actionType"); action != "" && action != "skip" {
+			continue
+		}
+		start, ok := seconds(record, "startTime")
+		if !ok {
+			continue
+		}
+		end, ok := seconds(record, "endTime")
+		if !ok {
+			continue
+		}
+		segment := Segment{
+			Category:  field(record, "category"),
+			EndTime:   end,
+			MediaID:   field(record, "videoID"),
+			MediaType: "youtube",
+			StartTime: start,
+			UUID:      uuid,
+		}
+		if segment.Validate() != nil {
+			continue
+		}
+		imported[uuid] = true
+		batch = append(batch, segment)
+		if len(batch) == segmentImportBatch {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, flush()
+}
@@ -0,0 +1,121 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// AddAnnouncement converts the audio file at sourcePath into an internal Media item that can be played for "Be
+// Quiet!" and stores it under the given title, leaving the source file alone. Identical files share the same ID, so
+// adding a file again returns the existing Media.
+func AddAnnouncement(sourcePath string, title string) (db.Media, error) {
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return db.Media{}, err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return db.Media{}, err
+	}
+	return storeAnnouncement(hex.EncodeToString(hash.Sum(nil))[:16], title, sourcePath)
+}
+
+// Speak generates a spoken announcement of text with the TTS command and stores it as an internal Media item like
+// AddAnnouncement. The voice is passed on to the TTS command if it isn't empty.
+func Speak(text string, voice string) (db.Media, error) {
+	if text == "" {
+		return db.Media{}, errors.New("announcement text cannot be empty")
+	}
+	hash := sha256.Sum256([]byte(voice + "\n" + text))
+	id := hex.EncodeToString(hash[:])[:16]
+	if media, err := db.GetMedia(id, "internal"); err == nil {
+		return media, nil
+	}
+
+	tempDir, err := ioutil.TempDir("", "prismriver-tts-")
+	if err != nil {
+		return db.Media{}, err
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			logrus.Warnf("error removing tts directory %v: %v", tempDir, err)
+		}
+	}()
+	wavPath := path.Join(tempDir, "announcement.wav")
+	args := []string{"-w", wavPath}
+	if voice != "" {
+		args = append(args, "-v", voice)
+	}
+	// Text starting with a dash would otherwise be taken as an option.
+	args = append(args, "--", text)
+	var stderr bytes.Buffer
+	cmd := exec.Command(viper.GetString(constants.TTS_COMMAND), args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return db.Media{}, errors.Wrapf(err, "could not generate announcement: %v", stderr.String())
+	}
+	return storeAnnouncement(id, text, wavPath)
+}
+
+// storeAnnouncement encodes the audio file at sourcePath to where internal Media is played from, probes its real
+// length, and adds it to the database. An existing announcement with the same ID is returned as is.
+func storeAnnouncement(id string, title string, sourcePath string) (db.Media, error) {
+	if media, err := db.GetMedia(id, "internal"); err == nil {
+		return media, nil
+	}
+	media := db.Media{
+		ID:    id,
+		Title: title,
+		Type:  "internal",
+	}
+	filePath := FilePath(media)
+	if err := os.MkdirAll(path.Dir(filePath), os.ModeDir|0755); err != nil {
+		return db.Media{}, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("ffmpeg", "-y", "-v", "error", "-i", sourcePath, "-vn", "-c:a", "libopus", filePath)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		removeAnnouncement(filePath)
+		return db.Media{}, errors.Wrapf(err, "could not encode announcement: %v", stderr.String())
+	}
+	result, err := Probe(filePath)
+	if err != nil {
+		removeAnnouncement(filePath)
+		return db.Media{}, err
+	}
+	if media.Length = result.Length(); media.Length == 0 {
+		removeAnnouncement(filePath)
+		return db.Media{}, errors.New("announcement is empty")
+	}
+	if err := db.AddMedia(media); err != nil {
+		removeAnnouncement(filePath)
+		return db.Media{}, err
+	}
+	logrus.Infof("added announcement %v with id %v", media.Title, media.ID)
+	return media, nil
+}
+
+// removeAnnouncement removes the encoded file of an announcement that could not be stored.
+func removeAnnouncement(filePath string) {
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("error removing announcement file %v: %v", filePath, err)
+	}
+}
@@ -0,0 +1,40 @@
+package downloader
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// backfillDelay is the time to wait between info requests when backfilling, to avoid being rate limited.
+const backfillDelay = 5 * time.Second
+
+// BackfillMetadata retrieves the artist, album, thumbnail, description, upload date and uploader for Media that was
+// added before these were recorded. Titles and lengths are left untouched. Every item is only tried once, since a
+// source that is gone or has no such metadata won't have it the next time either.
+func BackfillMetadata() {
+	media, err := db.GetMediaWithoutMetadata()
+	if err != nil {
+		logrus.Errorf("could not look up media for metadata backfill: %v", err)
+		return
+	}
+	if len(media) == 0 {
+		return
+	}
+	logrus.Infof("backfilling metadata for %v media items", len(media))
+	for _, item := range media {
+		newMedia, err := GetInfo(item.URL, item.Video)
+		if err != nil {
+			logrus.Warnf("could not get info for media with url %v, skipping: %v", item.URL, err)
+		} else {
+			item.UpdateMetadata(newMedia)
+		}
+		checkedAt := time.Now()
+		item.MetadataCheckedAt = &checkedAt
+		item.Save()
+		time.Sleep(backfillDelay)
+	}
+	logrus.Info("finished backfilling metadata")
+}
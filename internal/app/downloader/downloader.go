@@ -1,12 +1,14 @@
 package downloader
 
 import (
+	"context"
 	"io"
+	"net/url"
 	"os"
 	"path"
 	"strings"
-	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/xfrr/goffmpeg/transcoder"
@@ -16,84 +18,115 @@ import (
 	"github.com/Safety-Third/prismriver/internal/app/db"
 )
 
-// DownloadMedia runs a download on a given item in a goroutine. This can be tracked using the returned channels.
-func DownloadMedia(media db.Media) (chan float64, chan error, error) {
+// DownloadMedia runs a download on a given item in a goroutine. This can be tracked using the returned channels. The
+// final file is written to PartialPath first, which is sent on the second channel as soon as transcoding starts if
+// the selected Profile can be played while it's still being written. Canceling ctx stops the download and removes
+// anything it has written so far.
+func DownloadMedia(ctx context.Context, media db.Media) (chan float64, chan string, chan error, error) {
+	if media.Stream {
+		return nil, nil, nil, errors.Errorf("media with id %v and type %v is a stream and cannot be downloaded",
+			media.ID, media.Type)
+	}
 	progressChan := make(chan float64)
+	// Buffered so that the download doesn't stall if nothing is waiting to play the partial file.
+	partialChan := make(chan string, 1)
 	doneChan := make(chan error)
 	go func() {
 		callDone := func(err error) {
 			close(progressChan)
+			close(partialChan)
 			doneChan <- err
 			close(doneChan)
 		}
-		downloader := youtubedl.NewDownloader(media.URL)
-
-		format := viper.GetString(constants.DOWNLOAD_FORMAT)
-		downloader.Format(format)
-		downloader.NoPlaylist()
-		downloader.Output(path.Join("/tmp", media.Type, media.ID))
-		eventChan, closeChan, err := downloader.RunProgress()
-		if err != nil {
-			logrus.Error("Error starting media download:\n", err)
-			callDone(err)
-			return
+		// Local media doesn't need to be downloaded, so transcoding makes up the entire progress.
+		sourcePath, local := LocalPath(media)
+		transcodeProgress := func(progress float64) float64 {
+			return progress
 		}
-		for progress := range eventChan {
-			logrus.Debugf("Download is at %f percent completion", progress)
-			progressChan <- progress / 2
+		if !local {
+			transcodeProgress = func(progress float64) float64 {
+				return progress/2 + 50
+			}
+			var err error
+			sourcePath, err = fetchSource(ctx, media, func(progress float64) {
+				logrus.Debugf("Download is at %f percent completion", progress)
+				progressChan <- progress / 2
+			})
+			if err != nil {
+				logrus.Error("Error downloading media file:\n", err)
+				callDone(err)
+				return
+			}
+			logrus.Debug("Downloaded media file")
 		}
-		result := <-closeChan
-		if result.Err != nil {
-			logrus.Error("Error downloading media file:\n", result.Err)
-			callDone(result.Err)
+
+		if err := ctx.Err(); err != nil {
+			callDone(err)
 			return
 		}
-		logrus.Debug("Downloaded media file")
-
 		dataDir := viper.GetString(constants.DATA)
 		dirPath := path.Join(dataDir, media.Type)
 		if err := os.MkdirAll(dirPath, os.ModeDir|0755); err != nil {
 			callDone(err)
 			return
 		}
-		if !media.Video || viper.GetBool(constants.VIDEO_TRANSCODING) {
-			trans := new(transcoder.Transcoder)
-			ext := ".opus"
-			if media.Video {
-				ext = ".mp4"
+		profile := GetProfile(media.Video)
+		filePath := FilePath(media)
+		partialPath := PartialPath(media)
+		// Partial files are never left behind under the final path, where they would be mistaken for a complete one.
+		fail := func(err error) {
+			if err := os.Remove(partialPath); err != nil && !os.IsNotExist(err) {
+				logrus.Warnf("error removing partial file: %v", err)
 			}
-			filePath := path.Join(dirPath, media.ID+ext)
-			err = trans.Initialize(result.Path, filePath)
+			callDone(err)
+		}
+		if !profile.Passthrough {
+			trans := new(transcoder.Transcoder)
+			err := trans.Initialize(sourcePath, partialPath)
 			if err != nil {
 				logrus.Error("Error starting transcoding process:\n", err)
 				callDone(err)
 				return
 			}
-			trans.MediaFile().SetAudioCodec("libopus")
-			if media.Video {
-				trans.MediaFile().SetVideoCodec("libx264")
-				// Needed to enable experimental Opus in the mp4 container format.
-				trans.MediaFile().SetStrict(-2)
-			} else {
-				trans.MediaFile().SetSkipVideo(true)
-			}
+			profile.apply(trans, media.Video)
 			logrus.Debug("Instantiated ffmpeg transcoder")
 
 			done := trans.Run(true)
+			stopped := make(chan struct{})
+			go func() {
+				select {
+				case <-ctx.Done():
+					if err := trans.Stop(); err != nil {
+						logrus.Warnf("error stopping transcoding process: %v", err)
+					}
+				case <-stopped:
+				}
+			}()
 			progress := trans.Output()
+			// ffmpeg has opened its output by the time that it reports any progress.
+			sentPartial := false
 			for msg := range progress {
-				progressChan <- msg.Progress/2 + 50
+				if !sentPartial && profile.Streamable() {
+					partialChan <- partialPath
+					sentPartial = true
+				}
+				progressChan <- transcodeProgress(msg.Progress)
 				logrus.Debug(msg)
 			}
-			if err := <-done; err != nil {
+			err = <-done
+			close(stopped)
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			if err != nil {
 				logrus.Error("Error in transcoding process:\n", err)
-				callDone(err)
+				fail(err)
 				return
 			}
-			logrus.Debug("Transcoded media to vorbis audio")
+			logrus.Debugf("Transcoded media to %v", profile.Container)
 		} else {
-			logrus.Debugf("video transcoding disabled, moving file to final destination")
-			input, err := os.Open(result.Path)
+			logrus.Debugf("transcoding disabled, moving file to final destination")
+			input, err := os.Open(sourcePath)
 			if err != nil {
 				logrus.Errorf("error reading original video file: %v", err)
 				callDone(err)
@@ -104,71 +137,95 @@ func DownloadMedia(media db.Media) (chan float64, chan error, error) {
 					logrus.Errorf("error closing input file: %v", err)
 				}
 			}()
-			output, err := os.Create(path.Join(dirPath, media.ID+".video"))
+			output, err := os.Create(partialPath)
 			if err != nil {
 				logrus.Errorf("error opening destination file: %v", err)
 				callDone(err)
 				return
 			}
-			defer func() {
-				if err := output.Close(); err != nil {
-					logrus.Errorf("error closing output file: %v", err)
-				}
-			}()
-			if _, err := io.Copy(output, input); err != nil {
+			_, err = io.Copy(output, input)
+			if closeErr := output.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
 				logrus.Errorf("error copying video file: %v", err)
-				callDone(err)
+				fail(err)
 				return
 			}
 		}
-		if err := os.Remove(result.Path); err != nil {
-			logrus.Warnf("error when removing temporary file: %v", err)
+		if err := os.Rename(partialPath, filePath); err != nil {
+			logrus.Errorf("error moving file to final destination: %v", err)
+			fail(err)
+			return
+		}
+		if !local {
+			if err := os.Remove(sourcePath); err != nil {
+				logrus.Warnf("error when removing temporary file: %v", err)
+			}
+			logrus.Debug("removed temporary youtube-dl file")
 		}
-		logrus.Debug("removed temporary youtube-dl file")
 		logrus.Infof("downloaded new file for media with id %v and type %v", media.ID, media.Type)
 		callDone(nil)
 	}()
-	return progressChan, doneChan, nil
+	return progressChan, partialChan, doneChan, nil
+}
+
+// PartialPath returns the path that the final file for the given Media is written to while it's being downloaded. The
+// extension is kept so that ffmpeg can still tell which container to write.
+func PartialPath(media db.Media) string {
+	filePath := FilePath(media)
+	ext := path.Ext(filePath)
+	return strings.TrimSuffix(filePath, ext) + ".part" + ext
+}
+
+// LocalPath returns the path of the source file for Media that is stored locally rather than downloaded, such as
+// uploaded files. The second return value is false for Media that must be downloaded.
+func LocalPath(media db.Media) (string, bool) {
+	parsed, err := url.Parse(media.URL)
+	if err != nil || parsed.Scheme != "file" {
+		return "", false
+	}
+	return parsed.Path, true
 }
 
 // GetInfo retrieves the info for a Media item synchronously.
 func GetInfo(url string, video bool) (db.Media, error) {
-	downloader := youtubedl.NewDownloader(url)
-	downloader.NoPlaylist()
-	info, err := downloader.GetInfo()
+	info, err := fetchInfo(url)
+	if err != nil {
+		return db.Media{}, err
+	}
+	return info.media(video), nil
+}
+
+// GetAllowedInfo retrieves the info for a Media item synchronously like GetInfo, but returns a RejectionError instead
+// if the Media breaks any of the rules for its extractor.
+func GetAllowedInfo(url string, video bool) (db.Media, error) {
+	info, err := fetchInfo(url)
 	if err != nil {
 		return db.Media{}, err
 	}
-	if video && info.VCodec == "none" {
-		video = false
+	if err := checkInfo(info); err != nil {
+		return db.Media{}, err
 	}
-	return db.Media{
-		ID:     info.ID,
-		Length: uint64(info.Duration * float64(time.Millisecond)),
-		Title:  info.Title,
-		Type:   info.Extractor,
-		Video:  video,
-		URL:    info.WebpageURL,
-	}, nil
+	return info.media(video), nil
 }
 
-// ValidateURL checks to see if the given URL is allowed to be played.
-func ValidateURL(url string) bool {
+// ValidateURL checks to see if the given URL is allowed to be played, returning a RejectionError with the reason if
+// not.
+func ValidateURL(url string) error {
+	if block, blocked, err := db.FindURLBlock(url); err != nil {
+		return err
+	} else if blocked {
+		return rejectf("%v is blocked: %v", url, block.Reason)
+	}
+	if err := checkDomain(url); err != nil {
+		return err
+	}
 	downloader := youtubedl.NewDownloader(url)
 	extractor, err := downloader.GetExtractor()
 	if err != nil {
 		logrus.Warnf("could not determine extractor for %v: %v", url, err)
-		return false
-	} else if extractor == "generic" {
-		return false
-	} else {
-		extractor = strings.Split(extractor, ":")[0]
-		allowedTypes := viper.GetStringSlice(constants.ALLOWED_TYPES)
-		for _, mediaType := range allowedTypes {
-			if extractor == mediaType {
-				return true
-			}
-		}
-		return false
+		return rejectf("%v is not supported", url)
 	}
+	return checkExtractor(extractor)
 }
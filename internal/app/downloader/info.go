@@ -0,0 +1,163 @@
+package downloader
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// binaries are the youtube-dl compatible binaries to look for, in order of preference.
+var binaries = []string{"yt-dlp", "youtube-dl"}
+
+// info represents the fields of youtube-dl's info JSON that are used for Media. youtube-dl-go only exposes a handful
+// of fields, so the JSON is parsed here instead.
+type info struct {
+	AgeLimit    int     `json:"age_limit"`
+	Album       string  `json:"album"`
+	Artist      string  `json:"artist"`
+	Channel     string  `json:"channel"`
+	Creator     string  `json:"creator"`
+	Description string  `json:"description"`
+	Duration    float64 `json:"duration"`
+	Extractor   string  `json:"extractor"`
+	ID          string  `json:"id"`
+	IsLive      bool    `json:"is_live"`
+	LiveStatus  string  `json:"live_status"`
+	Thumbnail   string  `json:"thumbnail"`
+	Title       string  `json:"title"`
+	Uploader    string  `json:"uploader"`
+	UploadDate  string  `json:"upload_date"`
+	VCodec      string  `json:"vcodec"`
+	WebpageURL  string  `json:"webpage_url"`
+}
+
+// findBinary returns the name of the preferred youtube-dl compatible binary that is installed.
+func findBinary() (string, error) {
+	for _, candidate := range binaries {
+		if _, err := exec.LookPath(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("youtube-dl binary not found")
+}
+
+// runBinary runs youtube-dl with the given arguments and returns its output.
+func runBinary(args ...string) ([]byte, error) {
+	binary, err := findBinary()
+	if err != nil {
+		return nil, err
+	}
+	output, err := exec.Command(binary, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, errors.Wrapf(err, "youtube-dl failed: %s", exitErr.Stderr)
+		}
+		return nil, err
+	}
+	return output, nil
+}
+
+// fetchInfo runs youtube-dl to retrieve the info JSON for the given URL.
+func fetchInfo(url string) (info, error) {
+	output, err := runBinary("--no-playlist", "--dump-json", "--", url)
+	if err != nil {
+		return info{}, err
+	}
+	var result info
+	if err := json.Unmarshal(output, &result); err != nil {
+		return info{}, errors.Wrap(err, "could not parse youtube-dl info")
+	}
+	return result, nil
+}
+
+// artist returns the artist of the media, falling back to the creator for extractors that don't report one.
+func (i info) artist() string {
+	if i.Artist != "" {
+		return i.Artist
+	}
+	return i.Creator
+}
+
+// uploader returns the uploader of the media, falling back to the channel for extractors that don't report one.
+func (i info) uploader() string {
+	if i.Uploader != "" {
+		return i.Uploader
+	}
+	return i.Channel
+}
+
+// uploadDate returns the parsed upload date of the media, or nil if unknown.
+func (i info) uploadDate() *time.Time {
+	if i.UploadDate == "" {
+		return nil
+	}
+	date, err := time.Parse("20060102", i.UploadDate)
+	if err != nil {
+		logrus.Debugf("could not parse upload date %v: %v", i.UploadDate, err)
+		return nil
+	}
+	return &date
+}
+
+// live returns whether or not the media is a livestream. Newer versions of yt-dlp also report upcoming streams.
+func (i info) live() bool {
+	return i.IsLive || i.LiveStatus == "is_live" || i.LiveStatus == "is_upcoming"
+}
+
+// media returns the Media described by the info. Video is disabled for media that has no video stream.
+func (i info) media(video bool) db.Media {
+	if video && i.VCodec == "none" {
+		video = false
+	}
+	length := uint64(i.Duration * float64(time.Millisecond))
+	if i.live() {
+		length = StreamLength()
+	}
+	return db.Media{
+		ID:          i.ID,
+		Album:       i.Album,
+		Artist:      i.artist(),
+		Description: i.Description,
+		Length:      length,
+		Stream:      i.live(),
+		Thumbnail:   i.Thumbnail,
+		Title:       i.Title,
+		Type:        i.Extractor,
+		UploadDate:  i.uploadDate(),
+		Uploader:    i.uploader(),
+		Video:       video,
+		URL:         i.WebpageURL,
+	}
+}
+
+// StreamURL resolves the URL that the given streaming Media can be played from directly.
+func StreamURL(media db.Media) (string, error) {
+	// Only formats that are a single file can be played directly, as formats that combine separate video and audio
+	// streams print one URL per stream. Video is limited to formats that come with audio for the same reason.
+	format := "bestaudio/best"
+	if media.Video {
+		format = "best[acodec!=none]"
+	}
+	output, err := runBinary("--no-playlist", "--get-url", "--format", format, "--", media.URL)
+	if err != nil {
+		return "", err
+	}
+	urls := strings.Fields(string(output))
+	if len(urls) == 0 {
+		return "", errors.Errorf("no stream url found for %v", media.URL)
+	}
+	return urls[0], nil
+}
+
+// StreamLength returns the maximum time that streaming Media is played for, in the same units as Media.Length.
+func StreamLength() uint64 {
+	return uint64(viper.GetDuration(constants.STREAM_MAX_DURATION).Seconds() * float64(time.Millisecond))
+}
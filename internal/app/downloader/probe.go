@@ -0,0 +1,126 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ProbeResult represents the output of ffprobe for a media file.
+type ProbeResult struct {
+	Format  ProbeFormat   `json:"format"`
+	Streams []ProbeStream `json:"streams"`
+}
+
+// ProbeFormat represents the container information of a probed media file.
+type ProbeFormat struct {
+	Duration   string            `json:"duration"`
+	FormatName string            `json:"format_name"`
+	Tags       map[string]string `json:"tags"`
+}
+
+// ProbeStream represents a single stream of a probed media file.
+type ProbeStream struct {
+	CodecName   string            `json:"codec_name"`
+	CodecType   string            `json:"codec_type"`
+	Disposition map[string]int    `json:"disposition"`
+	Tags        map[string]string `json:"tags"`
+}
+
+// Probe runs ffprobe on the file at filePath and returns its format and stream information.
+func Probe(filePath string) (ProbeResult, error) {
+	var out bytes.Buffer
+	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams",
+		filePath)
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return ProbeResult{}, errors.Wrapf(err, "could not probe %v", filePath)
+	}
+	var result ProbeResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		return ProbeResult{}, errors.Wrapf(err, "could not parse probe output for %v", filePath)
+	}
+	return result, nil
+}
+
+// Codec returns the codec name of the first stream of the given type ("audio" or "video"), or an empty string if the
+// file has no such stream.
+func (r ProbeResult) Codec(codecType string) string {
+	for _, stream := range r.Streams {
+		if stream.CodecType == codecType {
+			return stream.CodecName
+		}
+	}
+	return ""
+}
+
+// HasVideo returns whether or not the probed file contains a video stream, ignoring embedded cover art.
+func (r ProbeResult) HasVideo() bool {
+	for _, stream := range r.Streams {
+		if stream.CodecType == "video" && stream.Disposition["attached_pic"] == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Length returns the duration of the probed file in the same units as Media.Length.
+func (r ProbeResult) Length() uint64 {
+	seconds, err := strconv.ParseFloat(r.Format.Duration, 64)
+	if err != nil {
+		return 0
+	}
+	return uint64(seconds * float64(time.Millisecond))
+}
+
+// formatSubtypes maps the container names reported by ffprobe to MIME subtypes.
+var formatSubtypes = map[string]string{
+	"aac":      "aac",
+	"aiff":     "aiff",
+	"flac":     "flac",
+	"matroska": "webm",
+	"mov":      "mp4",
+	"mp3":      "mpeg",
+	"mp4":      "mp4",
+	"ogg":      "ogg",
+	"wav":      "wav",
+	"webm":     "webm",
+}
+
+// MimeType returns the MIME type of the probed file based on its actual container rather than its name, or an empty
+// string if the container isn't known. The type is video/ if the file has video and audio/ otherwise.
+func (r ProbeResult) MimeType() string {
+	for _, name := range strings.Split(r.Format.FormatName, ",") {
+		subtype, ok := formatSubtypes[name]
+		if !ok {
+			continue
+		}
+		if r.HasVideo() {
+			return "video/" + subtype
+		}
+		return "audio/" + subtype
+	}
+	return ""
+}
+
+// Tag returns the value of the given metadata tag, ignoring case. Container tags take precedence over stream tags.
+func (r ProbeResult) Tag(name string) string {
+	for key, value := range r.Format.Tags {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	for _, stream := range r.Streams {
+		for key, value := range stream.Tags {
+			if strings.EqualFold(key, name) {
+				return value
+			}
+		}
+	}
+	return ""
+}
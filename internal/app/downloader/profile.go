@@ -0,0 +1,168 @@
+package downloader
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/xfrr/goffmpeg/transcoder"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// Profile represents a named set of transcoding options used to produce the final file for downloaded Media.
+type Profile struct {
+	// AudioBitrate is the target audio bitrate passed to ffmpeg, such as "128k".
+	AudioBitrate string `mapstructure:"audio_bitrate"`
+	// AudioCodec is the ffmpeg audio encoder to use.
+	AudioCodec string `mapstructure:"audio_codec"`
+	// Container is the output container format, which is also used as the extension of the final file.
+	Container string `mapstructure:"container"`
+	// MaxHeight caps the vertical resolution of video output, keeping the aspect ratio. 0 disables the cap.
+	MaxHeight int `mapstructure:"max_height"`
+	// Passthrough skips transcoding entirely and stores the downloaded file as-is.
+	Passthrough bool `mapstructure:"passthrough"`
+	// Preset is the encoder preset to use for video, such as "veryfast" for libx264.
+	Preset string `mapstructure:"preset"`
+	// Strict is passed to ffmpeg's -strict option, which is needed for experimental codec and container pairs.
+	Strict int `mapstructure:"strict"`
+	// VideoBitrate is the target video bitrate in bits per second. 0 leaves the encoder default.
+	VideoBitrate int `mapstructure:"video_bitrate"`
+	// VideoCodec is the ffmpeg video encoder to use.
+	VideoCodec string `mapstructure:"video_codec"`
+}
+
+// Names of the built-in transcoding profiles.
+const (
+	// PROFILE_H264 transcodes video to H.264 with Opus audio in an mp4 container.
+	PROFILE_H264 = "h264"
+	// PROFILE_OPUS transcodes audio to Opus, dropping any video.
+	PROFILE_OPUS = "opus"
+	// PROFILE_ORIGINAL stores the downloaded file without transcoding.
+	PROFILE_ORIGINAL = "original"
+)
+
+// streamableContainers are the containers that can be played back while ffmpeg is still writing them. Containers
+// like mp4 only become playable once ffmpeg writes their index at the very end.
+var streamableContainers = []string{"mkv", "ogg", "opus", "ts", "webm"}
+
+var builtinProfiles = map[string]Profile{
+	PROFILE_H264: {
+		AudioCodec: "libopus",
+		Container:  "mp4",
+		// Needed to enable experimental Opus in the mp4 container format.
+		Strict:     -2,
+		VideoCodec: "libx264",
+	},
+	PROFILE_OPUS: {
+		AudioCodec: "libopus",
+		Container:  "opus",
+	},
+	PROFILE_ORIGINAL: {
+		Container:   "video",
+		Passthrough: true,
+	},
+}
+
+// GetProfiles returns all available transcoding profiles, including the built-in ones unless overridden in the
+// configuration.
+func GetProfiles() map[string]Profile {
+	profiles := make(map[string]Profile)
+	for name, profile := range builtinProfiles {
+		profiles[name] = profile
+	}
+	configured := make(map[string]Profile)
+	if err := viper.UnmarshalKey(constants.TRANSCODING_PROFILES, &configured); err != nil {
+		logrus.Errorf("could not parse %v, ignoring: %v", constants.TRANSCODING_PROFILES, err)
+		return profiles
+	}
+	for name, profile := range configured {
+		profiles[name] = profile
+	}
+	return profiles
+}
+
+// GetProfile returns the transcoding profile selected for audio or video Media.
+func GetProfile(video bool) Profile {
+	_, profile := selectProfile(video)
+	return profile
+}
+
+// GetProfileName returns the name of the transcoding profile selected for audio or video Media.
+func GetProfileName(video bool) string {
+	name, _ := selectProfile(video)
+	return name
+}
+
+// selectProfile returns the name and options of the transcoding profile selected for audio or video Media.
+func selectProfile(video bool) (string, Profile) {
+	name := viper.GetString(constants.AUDIO_PROFILE)
+	fallback := PROFILE_OPUS
+	if video {
+		fallback = PROFILE_H264
+		if !viper.GetBool(constants.VIDEO_TRANSCODING) {
+			fallback = PROFILE_ORIGINAL
+		}
+		name = viper.GetString(constants.VIDEO_PROFILE)
+	}
+	if name == "" {
+		name = fallback
+	}
+	profile, ok := GetProfiles()[name]
+	if !ok {
+		logrus.Warnf("transcoding profile %v does not exist, using %v instead", name, fallback)
+		return fallback, builtinProfiles[fallback]
+	}
+	return name, profile
+}
+
+// Extension returns the file extension of files produced by the Profile.
+func (p Profile) Extension() string {
+	return "." + p.Container
+}
+
+// Streamable returns whether or not files produced by the Profile can be played while they're still being written.
+func (p Profile) Streamable() bool {
+	if p.Passthrough {
+		// The container of passthrough files is whatever was downloaded.
+		return false
+	}
+	for _, container := range streamableContainers {
+		if p.Container == container {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets the Profile's options on the given transcoder.
+func (p Profile) apply(trans *transcoder.Transcoder, video bool) {
+	file := trans.MediaFile()
+	file.SetAudioCodec(p.AudioCodec)
+	file.SetAudioBitRate(p.AudioBitrate)
+	file.SetStrict(p.Strict)
+	if !video || p.VideoCodec == "" {
+		file.SetSkipVideo(true)
+		return
+	}
+	file.SetVideoCodec(p.VideoCodec)
+	file.SetVideoBitRate(p.VideoBitrate)
+	file.SetPreset(p.Preset)
+	if p.MaxHeight > 0 {
+		// -2 keeps the width divisible by 2, which most encoders require.
+		file.SetVideoFilter(fmt.Sprintf("scale=-2:'min(%d,ih)'", p.MaxHeight))
+	}
+}
+
+// FilePath returns the path that the final file for the given Media is stored at under its selected Profile. Files
+// that already exist should be looked up through the storage package instead.
+func FilePath(media db.Media) string {
+	dataDir := viper.GetString(constants.DATA)
+	if media.Type == "internal" {
+		// Internal media is bundled with the application and never transcoded.
+		return path.Join(dataDir, media.Type, media.ID+".opus")
+	}
+	return path.Join(dataDir, media.Type, media.ID+GetProfile(media.Video).Extension())
+}
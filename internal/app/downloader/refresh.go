@@ -0,0 +1,149 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+var refreshInstance *Refresher
+var refreshOnce sync.Once
+
+// Refresher retrieves the current metadata of every downloaded Media item in the background, keeping track of items
+// whose source can no longer be retrieved.
+type Refresher struct {
+	sync.RWMutex
+
+	status RefreshStatus
+}
+
+// RefreshStatus represents the progress of the current or most recent metadata refresh.
+type RefreshStatus struct {
+	Dead      []DeadMedia `json:"dead"`
+	Finished  *time.Time  `json:"finished"`
+	Processed int         `json:"processed"`
+	Running   bool        `json:"running"`
+	Started   *time.Time  `json:"started"`
+	Total     int         `json:"total"`
+	Updated   int         `json:"updated"`
+}
+
+// DeadMedia represents a Media item whose source URL could not be retrieved during a refresh.
+type DeadMedia struct {
+	Error string `json:"error"`
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	URL   string `json:"url"`
+}
+
+// GetRefresher returns the single Refresher instance of the application.
+func GetRefresher() *Refresher {
+	refreshOnce.Do(func() {
+		refreshInstance = &Refresher{
+			status: RefreshStatus{
+				Dead: make([]DeadMedia, 0),
+			},
+		}
+	})
+	return refreshInstance
+}
+
+// Start begins refreshing the metadata of all downloaded Media, returning an error if a refresh is already running.
+// Start is thread-safe.
+func (r *Refresher) Start() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.status.Running {
+		return errors.New("a refresh is already running")
+	}
+	media, err := db.GetRemoteMedia()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	r.status = RefreshStatus{
+		Dead:    make([]DeadMedia, 0),
+		Running: true,
+		Started: &now,
+		Total:   len(media),
+	}
+	go r.run(media)
+	logrus.Infof("refreshing metadata for %v media items", len(media))
+	return nil
+}
+
+// Status returns the progress of the current or most recent refresh. Status is thread-safe.
+func (r *Refresher) Status() RefreshStatus {
+	r.RLock()
+	defer r.RUnlock()
+	status := r.status
+	status.Dead = append([]DeadMedia(nil), r.status.Dead...)
+	return status
+}
+
+// run refreshes each of the given Media in turn, waiting between requests to avoid being rate limited.
+func (r *Refresher) run(media []db.Media) {
+	for i, item := range media {
+		if i > 0 {
+			time.Sleep(backfillDelay)
+		}
+		updated, err := refresh(item)
+		r.Lock()
+		r.status.Processed++
+		if err != nil {
+			logrus.Warnf("could not refresh media with url %v: %v", item.URL, err)
+			r.status.Dead = append(r.status.Dead, DeadMedia{
+				Error: err.Error(),
+				ID:    item.ID,
+				Title: item.Title,
+				Type:  item.Type,
+				URL:   item.URL,
+			})
+		} else if updated {
+			r.status.Updated++
+		}
+		r.Unlock()
+	}
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now()
+	r.status.Finished = &now
+	r.status.Running = false
+	logrus.Infof("finished refreshing metadata: %v updated, %v dead", r.status.Updated, len(r.status.Dead))
+}
+
+// refresh retrieves the current title, length and metadata of the given Media and saves them if anything changed.
+// Overridden fields are left alone.
+func refresh(media db.Media) (bool, error) {
+	newMedia, err := GetInfo(media.URL, media.Video)
+	if err != nil {
+		return false, err
+	}
+	original := media
+	if !media.IsOverridden("title") {
+		media.Title = newMedia.Title
+	}
+	media.Length = newMedia.Length
+	media.UpdateMetadata(newMedia)
+	if media.Title == original.Title && media.Length == original.Length && media.Album == original.Album &&
+		media.Artist == original.Artist && media.Description == original.Description &&
+		media.Thumbnail == original.Thumbnail && media.Uploader == original.Uploader &&
+		uploadDateEqual(media.UploadDate, original.UploadDate) {
+		return false, nil
+	}
+	media.Save()
+	return true, nil
+}
+
+// uploadDateEqual returns whether or not two optional upload dates are the same.
+func uploadDateEqual(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
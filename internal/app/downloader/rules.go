@@ -0,0 +1,163 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// Rules represents the restrictions on Media from an extractor. Unset fields in per-extractor rules fall back to the
+// global settings.
+type Rules struct {
+	AllowAgeRestricted *bool          `mapstructure:"allow_age_restricted"`
+	AllowLivestreams   *bool          `mapstructure:"allow_livestreams"`
+	MaxDuration        *time.Duration `mapstructure:"max_duration"`
+}
+
+// RejectionError represents Media that isn't allowed to be queued. Its message is meant to be shown to the client.
+type RejectionError struct {
+	Reason string
+}
+
+func (e RejectionError) Error() string {
+	return e.Reason
+}
+
+// rejectf returns a RejectionError with a formatted reason.
+func rejectf(format string, args ...interface{}) error {
+	return RejectionError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// GetRules returns the rules for Media from the given extractor, taking any per-extractor overrides into account.
+func GetRules(extractor string) Rules {
+	allowAgeRestricted := viper.GetBool(constants.ALLOW_AGE_RESTRICTED)
+	allowLivestreams := viper.GetBool(constants.ALLOW_LIVESTREAMS)
+	maxDuration := viper.GetDuration(constants.MAX_DURATION)
+	rules := Rules{
+		AllowAgeRestricted: &allowAgeRestricted,
+		AllowLivestreams:   &allowLivestreams,
+		MaxDuration:        &maxDuration,
+	}
+	configured := make(map[string]Rules)
+	if err := viper.UnmarshalKey(constants.EXTRACTOR_RULES, &configured); err != nil {
+		logrus.Errorf("could not parse %v, ignoring: %v", constants.EXTRACTOR_RULES, err)
+		return rules
+	}
+	override, ok := configured[strings.Split(extractor, ":")[0]]
+	if !ok {
+		return rules
+	}
+	if override.AllowAgeRestricted != nil {
+		rules.AllowAgeRestricted = override.AllowAgeRestricted
+	}
+	if override.AllowLivestreams != nil {
+		rules.AllowLivestreams = override.AllowLivestreams
+	}
+	if override.MaxDuration != nil {
+		rules.MaxDuration = override.MaxDuration
+	}
+	return rules
+}
+
+// ValidateMedia checks to see if Media that is already known is allowed to be played between start and end, returning
+// a RejectionError with the reason if not. Everything but the age restriction can be checked without retrieving the
+// info again.
+func ValidateMedia(media db.Media, start uint64, end uint64) error {
+	if media.Type == "internal" {
+		return nil
+	}
+	// Local Media has no domain, and its type isn't an extractor.
+	if !media.IsLocal() {
+		if err := checkDomain(media.URL); err != nil {
+			return err
+		}
+		if err := checkExtractor(media.Type); err != nil {
+			return err
+		}
+	}
+	rules := GetRules(media.Type)
+	if media.Stream {
+		if !*rules.AllowLivestreams {
+			return rejectf("%v is a livestream, which is not allowed", media.Title)
+		}
+		// Streams are cut off after stream_max_duration instead.
+		return nil
+	}
+	// Media.Length is in seconds multiplied by time.Millisecond.
+	return checkLength(media.Title, time.Duration(media.Trimmed(start, end)/uint64(time.Millisecond))*time.Second,
+		*rules.MaxDuration)
+}
+
+// checkInfo checks freshly retrieved info against the rules for its extractor.
+func checkInfo(info info) error {
+	rules := GetRules(info.Extractor)
+	if info.live() && !*rules.AllowLivestreams {
+		return rejectf("%v is a livestream, which is not allowed", info.Title)
+	}
+	if info.AgeLimit >= 18 && !*rules.AllowAgeRestricted {
+		return rejectf("%v is age restricted, which is not allowed", info.Title)
+	}
+	if info.live() {
+		// Streams are cut off after stream_max_duration instead.
+		return nil
+	}
+	return checkLength(info.Title, time.Duration(info.Duration*float64(time.Second)), *rules.MaxDuration)
+}
+
+// checkLength rejects Media that is longer than maxDuration. A maxDuration of 0 allows any length.
+func checkLength(title string, length time.Duration, maxDuration time.Duration) error {
+	if maxDuration > 0 && length > maxDuration {
+		return rejectf("%v is %v long, longer than the maximum of %v", title, length.Round(time.Second),
+			maxDuration)
+	}
+	return nil
+}
+
+// checkDomain checks the domain of the given URL against the allowed and denied domains.
+func checkDomain(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return rejectf("%v is not a valid url", rawURL)
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, domain := range viper.GetStringSlice(constants.DENIED_DOMAINS) {
+		if matchDomain(host, domain) {
+			return rejectf("media from %v is not allowed", host)
+		}
+	}
+	allowedDomains := viper.GetStringSlice(constants.ALLOWED_DOMAINS)
+	if len(allowedDomains) == 0 {
+		return nil
+	}
+	for _, domain := range allowedDomains {
+		if matchDomain(host, domain) {
+			return nil
+		}
+	}
+	return rejectf("media from %v is not allowed", host)
+}
+
+// checkExtractor checks that Media from the given extractor is allowed by allowed_types. The generic extractor, used
+// for things like radio streams, is only allowed if it is listed explicitly.
+func checkExtractor(extractor string) error {
+	extractor = strings.Split(extractor, ":")[0]
+	for _, mediaType := range viper.GetStringSlice(constants.ALLOWED_TYPES) {
+		if extractor == mediaType {
+			return nil
+		}
+	}
+	return rejectf("media from %v is not allowed", extractor)
+}
+
+// matchDomain returns whether or not host is the given domain or one of its subdomains.
+func matchDomain(host string, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
@@ -0,0 +1,138 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// Patterns for the lines that youtube-dl prints while downloading, which are the same for yt-dlp.
+var (
+	destinationPattern = regexp.MustCompile(`^\[download] Destination: (.+)$`)
+	existingPattern    = regexp.MustCompile(`^\[download] (.*) has already been downloaded( and merged)?$`)
+	mergePattern       = regexp.MustCompile(`^\[.*] Merging formats into "(.+)"$`)
+	progressPattern    = regexp.MustCompile(`(\d+\.\d+)%`)
+	// stagePattern matches the destination of one of several formats that are merged afterwards.
+	stagePattern = regexp.MustCompile(`^\[download] Destination: .+\.f\d+\.?.*$`)
+)
+
+// fetchSource downloads the source file of the given Media with youtube-dl and returns its path, sending progress
+// from 0 to 100 to progress along the way. The download is killed and its files removed if ctx is canceled.
+// youtube-dl is run directly rather than through youtube-dl-go, which has no way to stop a running download.
+func fetchSource(ctx context.Context, media db.Media, progress func(float64)) (string, error) {
+	binary, err := findBinary()
+	if err != nil {
+		return "", err
+	}
+	output := path.Join("/tmp", media.Type, media.ID)
+	cmd := exec.Command(binary, "--newline", "--format", viper.GetString(constants.DOWNLOAD_FORMAT),
+		"--no-playlist", "--output", output, "--", media.URL)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+	// youtube-dl runs ffmpeg for merging formats, so the whole process group is killed when stopping it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+				logrus.Warnf("error stopping youtube-dl: %v", err)
+			}
+		case <-finished:
+		}
+	}()
+
+	lastError := make(chan string, 1)
+	go func() {
+		last := ""
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			if text := scanner.Text(); strings.HasPrefix(text, "ERROR") {
+				last = text
+			}
+		}
+		lastError <- last
+	}()
+	var sourcePath string
+	stage := -1.
+	stages := 1.
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		text := scanner.Text()
+		logrus.Debug(text)
+		if res := mergePattern.FindStringSubmatch(text); res != nil {
+			sourcePath = res[1]
+			continue
+		}
+		if !strings.HasPrefix(text, "[download]") {
+			continue
+		}
+		if stagePattern.MatchString(text) {
+			stages = 2
+			stage++
+		} else if res := destinationPattern.FindStringSubmatch(text); res != nil {
+			sourcePath = res[1]
+			stage++
+		} else if res := existingPattern.FindStringSubmatch(text); res != nil {
+			sourcePath = res[1]
+		} else if res := progressPattern.FindStringSubmatch(text); res != nil {
+			if value, err := strconv.ParseFloat(res[1], 64); err == nil {
+				progress(value/stages + 100/stages*stage)
+			}
+		}
+	}
+	waitErr := cmd.Wait()
+	message := <-lastError
+	if ctx.Err() != nil {
+		removeSource(output)
+		return "", ctx.Err()
+	}
+	if waitErr != nil {
+		if message == "" {
+			message = waitErr.Error()
+		}
+		return "", errors.New(message)
+	}
+	if sourcePath == "" {
+		return "", errors.New("could not determine where youtube-dl downloaded to")
+	}
+	return sourcePath, nil
+}
+
+// removeSource removes any files left behind by a youtube-dl download that was stopped, which all start with the
+// output template.
+func removeSource(output string) {
+	matches, err := filepath.Glob(output + "*")
+	if err != nil {
+		return
+	}
+	for _, match := range matches {
+		if err := os.Remove(match); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("error removing stopped download %v: %v", match, err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/downloader"
+	"github.com/Safety-Third/prismriver/internal/app/player"
+	"github.com/Safety-Third/prismriver/internal/app/storage"
+)
+
+// MEDIA_TYPE is the Media type used for files found in the library directories.
+const MEDIA_TYPE = "library"
+
+// debounce is how long to wait after the last filesystem change before rescanning, so that copying a whole album
+// only results in a single scan.
+const debounce = 10 * time.Second
+
+// extensions are the file extensions that are considered to be music files.
+var extensions = map[string]bool{
+	".aac":  true,
+	".aiff": true,
+	".alac": true,
+	".flac": true,
+	".m4a":  true,
+	".mp3":  true,
+	".ogg":  true,
+	".opus": true,
+	".wav":  true,
+	".wma":  true,
+}
+
+var scanLock sync.Mutex
+
+// Start performs an initial scan of the library directories and keeps the library up to date afterwards, either by
+// rescanning periodically or by watching the directories for changes, depending on the configuration.
+func Start() {
+	if len(viper.GetStringSlice(constants.LIBRARY_DIRS)) == 0 {
+		return
+	}
+	go func() {
+		if err := Scan(); err != nil {
+			logrus.Errorf("error scanning library: %v", err)
+		}
+	}()
+	if interval := viper.GetDuration(constants.LIBRARY_SCAN_INTERVAL); interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				if err := Scan(); err != nil {
+					logrus.Errorf("error scanning library: %v", err)
+				}
+			}
+		}()
+	}
+	if viper.GetBool(constants.LIBRARY_WATCH) {
+		if err := watch(); err != nil {
+			logrus.Errorf("could not watch library directories for changes: %v", err)
+		}
+	}
+}
+
+// Scan walks the library directories, adding or updating Media for any new or changed music files and removing Media
+// for files that no longer exist. Scan is thread-safe.
+func Scan() error {
+	scanLock.Lock()
+	defer scanLock.Unlock()
+	logrus.Info("scanning music library")
+
+	existing, err := db.GetMediaByType(MEDIA_TYPE)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]db.Media)
+	for _, media := range existing {
+		known[media.ID] = media
+	}
+
+	found := make(map[string]bool)
+	added := 0
+	for _, dir := range viper.GetStringSlice(constants.LIBRARY_DIRS) {
+		// Bail out instead of treating every file as removed when a directory is unavailable, such as an unmounted
+		// network share.
+		if _, err := os.Stat(dir); err != nil {
+			return err
+		}
+		err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				logrus.Warnf("error reading %v in library, skipping: %v", filePath, err)
+				return nil
+			}
+			if info.IsDir() || !extensions[strings.ToLower(filepath.Ext(filePath))] {
+				return nil
+			}
+			absolute, err := filepath.Abs(filePath)
+			if err != nil {
+				return err
+			}
+			id := mediaID(absolute)
+			found[id] = true
+			old, ok := known[id]
+			if ok && !info.ModTime().After(old.UpdatedAt) {
+				return nil
+			}
+			media, err := readMedia(id, absolute)
+			if err != nil {
+				logrus.Warnf("could not read tags of %v, skipping: %v", filePath, err)
+				return nil
+			}
+			if ok {
+				// Only what comes from the file is refreshed, so overrides, trim points and the thumbnail are kept.
+				updated := old
+				updated.UpdateMetadata(media)
+				updated.Length = media.Length
+				updated.Thumbnail = old.Thumbnail
+				if !old.IsOverridden("title") {
+					updated.Title = media.Title
+				}
+				updated.Save()
+			} else if err := db.AddMedia(media); err != nil {
+				return err
+			}
+			added++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	removed := 0
+	for id, media := range known {
+		if found[id] {
+			continue
+		}
+		// The Queue still refers to the record of queued media, so it's left for a later scan.
+		if player.GetQueue().Has(media) {
+			logrus.Debugf("missing library media with id %v is queued, removing it on a later scan", id)
+			continue
+		}
+		if err := storage.Remove(media); err != nil {
+			logrus.Errorf("could not remove stored files of missing library media with id %v: %v", id, err)
+			continue
+		}
+		if err := db.DeleteMedia(media); err != nil {
+			logrus.Errorf("could not remove missing library media with id %v: %v", id, err)
+			continue
+		}
+		removed++
+	}
+	logrus.Infof("finished scanning music library: %v added or updated, %v removed", added, removed)
+	return nil
+}
+
+// mediaID returns the ID of the Media for the music file at the given absolute path.
+func mediaID(filePath string) string {
+	hash := sha256.Sum256([]byte(filePath))
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+// readMedia creates a Media item from the tags of the music file at the given absolute path.
+func readMedia(id string, filePath string) (db.Media, error) {
+	result, err := downloader.Probe(filePath)
+	if err != nil {
+		return db.Media{}, err
+	}
+	title := result.Tag("title")
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	}
+	return db.Media{
+		ID:     id,
+		Album:  result.Tag("album"),
+		Artist: result.Tag("artist"),
+		Length: result.Length(),
+		Title:  title,
+		Type:   MEDIA_TYPE,
+		URL:    (&url.URL{Scheme: "file", Path: filePath}).String(),
+	}, nil
+}
+
+// watch rescans the library whenever files in the library directories change.
+func watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// fsnotify doesn't watch directories recursively, so every subdirectory needs to be added.
+	addDirs := func(root string) {
+		err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() {
+				if err := watcher.Add(filePath); err != nil {
+					logrus.Warnf("could not watch %v for changes: %v", filePath, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logrus.Warnf("could not watch %v for changes: %v", root, err)
+		}
+	}
+	for _, dir := range viper.GetStringSlice(constants.LIBRARY_DIRS) {
+		addDirs(dir)
+	}
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&fsnotify.Create != 0 {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						addDirs(event.Name)
+					}
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(debounce, func() {
+					if err := Scan(); err != nil {
+						logrus.Errorf("error scanning library: %v", err)
+					}
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Warnf("error watching library directories: %v", err)
+			}
+		}
+	}()
+	return nil
+}
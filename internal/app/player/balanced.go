@@ -1,13 +1,44 @@
 package player
 
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
 // InsertQueueItemBalanced inserts a given QueueItem into a given slice of QueueItems based on fairness, returning the
-// result.
+// result. Fairness is based on how long each owner's QueueItems play for once trimmed, including anything they played
+// within the fairness window.
 func InsertQueueItemBalanced(item *QueueItem, queue []*QueueItem) []*QueueItem {
-	priority := make(map[uint32]uint64)
+	played := playedPriority(func(total db.PlayTotal) float64 {
+		return float64(total.Length)
+	})
+	return insertQueueItemFair(item, queue, played, func(existing *QueueItem) float64 {
+		return float64(existing.length())
+	})
+}
+
+// insertQueueItemFair inserts a given QueueItem into a given slice of QueueItems ahead of the first item whose owner
+// has already had more played or queued before it than the QueueItem's owner, returning the result. priority starts
+// out as how much each owner has already played, and cost determines how much each QueueItem counts towards its
+// owner's total.
+func insertQueueItemFair(item *QueueItem, queue []*QueueItem, priority map[uint32]float64,
+	cost func(*QueueItem) float64) []*QueueItem {
 	for index, existing := range queue {
 		if !existing.balanced {
 			continue
 		}
+		if index == 0 {
+			// The currently playing item always stays first. It isn't in the play history until it's done playing, so
+			// it counts towards its owner's total like the rest of the Queue.
+			priority[existing.owner] += cost(existing)
+			continue
+		}
 		if existingTotal, ok := priority[existing.owner]; ok {
 			if itemTotal, ok := priority[item.owner]; ok {
 				if existing.owner != item.owner && existingTotal > itemTotal  {
@@ -15,7 +46,7 @@ func InsertQueueItemBalanced(item *QueueItem, queue []*QueueItem) []*QueueItem {
 					queue[index] = item
 					return queue
 				} else {
-					priority[existing.owner] += existing.Media.Length
+					priority[existing.owner] += cost(existing)
 				}
 			} else {
 				queue = append(queue[:index + 1], queue[index:]...)
@@ -23,8 +54,55 @@ func InsertQueueItemBalanced(item *QueueItem, queue []*QueueItem) []*QueueItem {
 				return queue
 			}
 		} else {
-			priority[existing.owner] = existing.Media.Length
+			priority[existing.owner] = cost(existing)
 		}
 	}
 	return append(queue, item)
 }
+
+// playTotalsMaxAge is how long the play history within the fairness window is cached for. It's only approximate
+// anyway, as plays leave the window one by one.
+const playTotalsMaxAge = time.Minute
+
+// playTotals caches the play history within the fairness window, so that it isn't looked up again for every
+// QueueItem that is inserted, such as when reordering the whole Queue.
+var playTotals struct {
+	sync.Mutex
+	loaded time.Time
+	totals []db.PlayTotal
+	window time.Duration
+}
+
+// playedPriority returns how much each owner played within the fairness window, as measured by cost. Nothing is
+// returned if the window is disabled.
+func playedPriority(cost func(db.PlayTotal) float64) map[uint32]float64 {
+	priority := make(map[uint32]float64)
+	window := viper.GetDuration(constants.FAIRNESS_WINDOW)
+	if window <= 0 {
+		return priority
+	}
+	playTotals.Lock()
+	defer playTotals.Unlock()
+	if playTotals.window != window || time.Since(playTotals.loaded) > playTotalsMaxAge {
+		totals, err := db.GetPlayTotals(time.Now().Add(-window))
+		if err != nil {
+			logrus.Errorf("could not look up play history, only considering the queue: %v", err)
+			return priority
+		}
+		playTotals.loaded = time.Now()
+		playTotals.totals = totals
+		playTotals.window = window
+	}
+	for _, total := range playTotals.totals {
+		priority[total.Owner] = cost(total)
+	}
+	return priority
+}
+
+// resetPlayTotals clears the cached play history so that the next QueueItem that is inserted sees a play that was just
+// recorded.
+func resetPlayTotals() {
+	playTotals.Lock()
+	defer playTotals.Unlock()
+	playTotals.loaded = time.Time{}
+}
@@ -0,0 +1,140 @@
+package player
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// Names of the built-in OrderingStrategies.
+const (
+	// ORDERING_BALANCED orders QueueItems so that each owner gets a similar amount of play time.
+	ORDERING_BALANCED = "balanced"
+	// ORDERING_FIFO plays QueueItems in the order that they were added.
+	ORDERING_FIFO = "fifo"
+	// ORDERING_ROUND_ROBIN orders QueueItems so that owners take turns, regardless of how long their items are.
+	ORDERING_ROUND_ROBIN = "round_robin"
+	// ORDERING_WEIGHTED orders QueueItems like ORDERING_BALANCED, but gives owners play time in proportion to their
+	// configured weights.
+	ORDERING_WEIGHTED = "weighted"
+)
+
+// OrderingStrategy decides where new QueueItems are inserted into the Queue.
+type OrderingStrategy interface {
+	// Insert inserts item into queue, returning the result. The first item of queue is currently playing and must
+	// stay first. QueueItems that aren't balanced were moved manually and are expected to be left where they are.
+	Insert(item *QueueItem, queue []*QueueItem) []*QueueItem
+}
+
+// OrderingStrategyFunc adapts a plain insertion function, such as InsertQueueItemBalanced, to an OrderingStrategy.
+type OrderingStrategyFunc func(item *QueueItem, queue []*QueueItem) []*QueueItem
+
+// Insert calls the underlying function.
+func (f OrderingStrategyFunc) Insert(item *QueueItem, queue []*QueueItem) []*QueueItem {
+	return f(item, queue)
+}
+
+// OwnerWeight is the configured weight of an owner for ORDERING_WEIGHTED.
+type OwnerWeight struct {
+	// Owner is the IP address that the owner adds QueueItems from.
+	Owner  string  `mapstructure:"owner"`
+	Weight float64 `mapstructure:"weight"`
+}
+
+var orderingStrategies = map[string]OrderingStrategy{
+	ORDERING_BALANCED:    OrderingStrategyFunc(InsertQueueItemBalanced),
+	ORDERING_FIFO:        OrderingStrategyFunc(InsertQueueItemDefault),
+	ORDERING_ROUND_ROBIN: OrderingStrategyFunc(InsertQueueItemRoundRobin),
+	ORDERING_WEIGHTED:    OrderingStrategyFunc(InsertQueueItemWeighted),
+}
+var orderingStrategiesLock sync.RWMutex
+
+// RegisterOrderingStrategy makes an OrderingStrategy selectable under the given name, replacing any existing one.
+// RegisterOrderingStrategy is thread-safe.
+func RegisterOrderingStrategy(name string, strategy OrderingStrategy) {
+	orderingStrategiesLock.Lock()
+	defer orderingStrategiesLock.Unlock()
+	orderingStrategies[name] = strategy
+}
+
+// GetOrderingStrategy returns the OrderingStrategy registered under the given name. GetOrderingStrategy is
+// thread-safe.
+func GetOrderingStrategy(name string) (OrderingStrategy, error) {
+	orderingStrategiesLock.RLock()
+	defer orderingStrategiesLock.RUnlock()
+	strategy, ok := orderingStrategies[name]
+	if !ok {
+		return nil, errors.Errorf("unknown queue ordering %v", name)
+	}
+	return strategy, nil
+}
+
+// GetOrderingStrategies returns the names of every registered OrderingStrategy in alphabetical order.
+// GetOrderingStrategies is thread-safe.
+func GetOrderingStrategies() []string {
+	orderingStrategiesLock.RLock()
+	defer orderingStrategiesLock.RUnlock()
+	names := make([]string, 0, len(orderingStrategies))
+	for name := range orderingStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InsertQueueItemRoundRobin inserts a given QueueItem into a given slice of QueueItems so that owners take turns,
+// counting anything they played within the fairness window as turns already taken, returning the result.
+func InsertQueueItemRoundRobin(item *QueueItem, queue []*QueueItem) []*QueueItem {
+	played := playedPriority(func(total db.PlayTotal) float64 {
+		return float64(total.Plays)
+	})
+	return insertQueueItemFair(item, queue, played, func(*QueueItem) float64 {
+		return 1
+	})
+}
+
+// InsertQueueItemWeighted inserts a given QueueItem into a given slice of QueueItems based on fairness like
+// InsertQueueItemBalanced, except that owners with a higher weight get proportionally more play time, returning the
+// result.
+func InsertQueueItemWeighted(item *QueueItem, queue []*QueueItem) []*QueueItem {
+	weights := ownerWeights()
+	weight := func(owner uint32) float64 {
+		if weight, ok := weights[owner]; ok {
+			return weight
+		}
+		return 1
+	}
+	played := playedPriority(func(total db.PlayTotal) float64 {
+		return float64(total.Length) / weight(total.Owner)
+	})
+	return insertQueueItemFair(item, queue, played, func(existing *QueueItem) float64 {
+		return float64(existing.length()) / weight(existing.owner)
+	})
+}
+
+// ownerWeights returns the configured weights of owners, keyed by owner. Invalid entries are ignored.
+func ownerWeights() map[uint32]float64 {
+	var configured []OwnerWeight
+	weights := make(map[uint32]float64)
+	if err := viper.UnmarshalKey(constants.OWNER_WEIGHTS, &configured); err != nil {
+		logrus.Errorf("could not parse %v, ignoring: %v", constants.OWNER_WEIGHTS, err)
+		return weights
+	}
+	for _, weight := range configured {
+		ip := net.ParseIP(weight.Owner).To4()
+		if ip == nil || weight.Weight <= 0 {
+			logrus.Warnf("ignoring invalid weight %v for owner %v", weight.Weight, weight.Owner)
+			continue
+		}
+		weights[binary.BigEndian.Uint32(ip)] = weight.Weight
+	}
+	return weights
+}
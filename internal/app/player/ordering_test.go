@@ -0,0 +1,268 @@
+package player
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// Owners of the QueueItems in the tests, which are the IP addresses 10.0.0.1, 10.0.0.2 and 10.0.0.3.
+const (
+	ownerA uint32 = 0x0a000001
+	ownerB uint32 = 0x0a000002
+	ownerC uint32 = 0x0a000003
+)
+
+// testItem returns a balanced QueueItem for the given owner whose Media has the given ID and plays for the given
+// number of seconds.
+func testItem(id string, owner uint32, seconds uint64) *QueueItem {
+	return &QueueItem{
+		balanced: true,
+		Media: db.Media{
+			ID:     id,
+			Length: seconds * uint64(time.Millisecond),
+		},
+		owner: owner,
+	}
+}
+
+// moved returns the given QueueItem as if it had been moved manually.
+func moved(item *QueueItem) *QueueItem {
+	item.balanced = false
+	return item
+}
+
+func TestOrderingStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		ordering string
+		weights  []map[string]interface{}
+		played   []db.PlayTotal
+		queue    []*QueueItem
+		item     *QueueItem
+		want     []string
+	}{
+		{
+			name:     "fifo adds to the bottom",
+			ordering: ORDERING_FIFO,
+			queue:    []*QueueItem{testItem("a1", ownerA, 60), testItem("a2", ownerA, 60)},
+			item:     testItem("b1", ownerB, 60),
+			want:     []string{"a1", "a2", "b1"},
+		},
+		{
+			name:     "fifo adds to an empty queue",
+			ordering: ORDERING_FIFO,
+			queue:    []*QueueItem{},
+			item:     testItem("a1", ownerA, 60),
+			want:     []string{"a1"},
+		},
+		{
+			name:     "balanced keeps the playing item first",
+			ordering: ORDERING_BALANCED,
+			queue:    []*QueueItem{testItem("a1", ownerA, 600), testItem("a2", ownerA, 60)},
+			item:     testItem("b1", ownerB, 60),
+			want:     []string{"a1", "b1", "a2"},
+		},
+		{
+			name:     "balanced goes by play time",
+			ordering: ORDERING_BALANCED,
+			queue: []*QueueItem{
+				testItem("c1", ownerC, 60),
+				testItem("a1", ownerA, 600),
+				testItem("b1", ownerB, 60),
+				testItem("a2", ownerA, 60),
+			},
+			item: testItem("b2", ownerB, 60),
+			want: []string{"c1", "a1", "b1", "b2", "a2"},
+		},
+		{
+			name:     "balanced counts play time within the fairness window",
+			ordering: ORDERING_BALANCED,
+			played:   []db.PlayTotal{{Length: 600 * uint64(time.Millisecond), Owner: ownerB, Plays: 1}},
+			queue: []*QueueItem{
+				testItem("a1", ownerA, 60),
+				testItem("a2", ownerA, 60),
+				testItem("a3", ownerA, 60),
+			},
+			item: testItem("b1", ownerB, 60),
+			want: []string{"a1", "a2", "a3", "b1"},
+		},
+		{
+			name:     "balanced skips moved items",
+			ordering: ORDERING_BALANCED,
+			queue: []*QueueItem{
+				testItem("a1", ownerA, 60),
+				testItem("b1", ownerB, 60),
+				moved(testItem("a2", ownerA, 60)),
+				testItem("b2", ownerB, 60),
+			},
+			item: testItem("c1", ownerC, 60),
+			want: []string{"a1", "b1", "a2", "c1", "b2"},
+		},
+		{
+			name:     "round robin keeps the playing item first",
+			ordering: ORDERING_ROUND_ROBIN,
+			queue:    []*QueueItem{testItem("a1", ownerA, 60), testItem("a2", ownerA, 60)},
+			item:     testItem("b1", ownerB, 60),
+			want:     []string{"a1", "b1", "a2"},
+		},
+		{
+			name:     "round robin takes turns regardless of length",
+			ordering: ORDERING_ROUND_ROBIN,
+			queue: []*QueueItem{
+				testItem("c1", ownerC, 60),
+				testItem("a1", ownerA, 600),
+				testItem("b1", ownerB, 60),
+				testItem("a2", ownerA, 60),
+			},
+			item: testItem("b2", ownerB, 60),
+			want: []string{"c1", "a1", "b1", "a2", "b2"},
+		},
+		{
+			name:     "round robin counts plays within the fairness window",
+			ordering: ORDERING_ROUND_ROBIN,
+			played:   []db.PlayTotal{{Length: 60 * uint64(time.Millisecond), Owner: ownerB, Plays: 1}},
+			queue: []*QueueItem{
+				testItem("a1", ownerA, 60),
+				testItem("a2", ownerA, 60),
+				testItem("a3", ownerA, 60),
+			},
+			item: testItem("b1", ownerB, 60),
+			want: []string{"a1", "a2", "b1", "a3"},
+		},
+		{
+			name:     "round robin skips moved items",
+			ordering: ORDERING_ROUND_ROBIN,
+			queue: []*QueueItem{
+				testItem("c1", ownerC, 60),
+				moved(testItem("a1", ownerA, 60)),
+				testItem("b1", ownerB, 60),
+				testItem("b2", ownerB, 60),
+			},
+			item: testItem("a2", ownerA, 60),
+			want: []string{"c1", "a1", "b1", "a2", "b2"},
+		},
+		{
+			name:     "weighted without weights is balanced",
+			ordering: ORDERING_WEIGHTED,
+			queue: []*QueueItem{
+				testItem("c1", ownerC, 60),
+				testItem("a1", ownerA, 600),
+				testItem("b1", ownerB, 60),
+				testItem("a2", ownerA, 60),
+			},
+			item: testItem("b2", ownerB, 60),
+			want: []string{"c1", "a1", "b1", "b2", "a2"},
+		},
+		{
+			name:     "weighted gives owners with higher weights more play time",
+			ordering: ORDERING_WEIGHTED,
+			weights:  []map[string]interface{}{{"owner": "10.0.0.1", "weight": 10}},
+			queue: []*QueueItem{
+				testItem("c1", ownerC, 60),
+				testItem("a1", ownerA, 600),
+				testItem("b1", ownerB, 60),
+				testItem("a2", ownerA, 60),
+			},
+			item: testItem("b2", ownerB, 60),
+			want: []string{"c1", "a1", "b1", "a2", "b2"},
+		},
+		{
+			name:     "weighted ignores invalid weights",
+			ordering: ORDERING_WEIGHTED,
+			weights: []map[string]interface{}{
+				{"owner": "10.0.0.1", "weight": -1},
+				{"owner": "not an address", "weight": 10},
+			},
+			queue: []*QueueItem{
+				testItem("c1", ownerC, 60),
+				testItem("a1", ownerA, 600),
+				testItem("b1", ownerB, 60),
+				testItem("a2", ownerA, 60),
+			},
+			item: testItem("b2", ownerB, 60),
+			want: []string{"c1", "a1", "b1", "b2", "a2"},
+		},
+		{
+			name:     "weighted keeps the playing item first",
+			ordering: ORDERING_WEIGHTED,
+			weights:  []map[string]interface{}{{"owner": "10.0.0.2", "weight": 10}},
+			queue:    []*QueueItem{testItem("a1", ownerA, 600), testItem("a2", ownerA, 60)},
+			item:     testItem("b1", ownerB, 60),
+			want:     []string{"a1", "b1", "a2"},
+		},
+		{
+			name:     "weighted divides play time within the fairness window by the weight",
+			ordering: ORDERING_WEIGHTED,
+			weights:  []map[string]interface{}{{"owner": "10.0.0.2", "weight": 10}},
+			played:   []db.PlayTotal{{Length: 600 * uint64(time.Millisecond), Owner: ownerB, Plays: 1}},
+			queue: []*QueueItem{
+				testItem("a1", ownerA, 60),
+				testItem("a2", ownerA, 60),
+				testItem("a3", ownerA, 60),
+			},
+			item: testItem("b1", ownerB, 60),
+			want: []string{"a1", "a2", "b1", "a3"},
+		},
+		{
+			name:     "weighted skips moved items",
+			ordering: ORDERING_WEIGHTED,
+			weights:  []map[string]interface{}{{"owner": "10.0.0.1", "weight": 2}},
+			queue: []*QueueItem{
+				testItem("a1", ownerA, 60),
+				testItem("b1", ownerB, 60),
+				moved(testItem("a2", ownerA, 60)),
+				testItem("b2", ownerB, 60),
+			},
+			item: testItem("c1", ownerC, 60),
+			want: []string{"a1", "b1", "a2", "c1", "b2"},
+		},
+	}
+	defer viper.Set(constants.FAIRNESS_WINDOW, nil)
+	defer viper.Set(constants.OWNER_WEIGHTS, nil)
+	defer resetPlayTotals()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set(constants.OWNER_WEIGHTS, test.weights)
+			// Without a fairness window, only the Queue is considered and the play history is never looked up.
+			// Otherwise, the cached play history is filled in so that the database isn't needed.
+			viper.Set(constants.FAIRNESS_WINDOW, 0)
+			if test.played != nil {
+				viper.Set(constants.FAIRNESS_WINDOW, time.Hour)
+				playTotals.Lock()
+				playTotals.loaded = time.Now()
+				playTotals.totals = test.played
+				playTotals.window = time.Hour
+				playTotals.Unlock()
+			}
+			strategy, err := GetOrderingStrategy(test.ordering)
+			if err != nil {
+				t.Fatal(err)
+			}
+			queue := strategy.Insert(test.item, test.queue)
+			got := make([]string, 0)
+			for _, item := range queue {
+				got = append(got, item.Media.ID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetOrderingStrategy(t *testing.T) {
+	for _, name := range []string{ORDERING_BALANCED, ORDERING_FIFO, ORDERING_ROUND_ROBIN, ORDERING_WEIGHTED} {
+		if _, err := GetOrderingStrategy(name); err != nil {
+			t.Errorf("%v is not registered: %v", name, err)
+		}
+	}
+	if _, err := GetOrderingStrategy("unknown"); err == nil {
+		t.Error("unknown ordering did not return an error")
+	}
+}
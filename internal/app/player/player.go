@@ -3,7 +3,7 @@ package player
 import (
 	"encoding/json"
 	"errors"
-	"path"
+	"fmt"
 	"sync"
 	"time"
 
@@ -12,8 +12,14 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/downloader"
+	"github.com/Safety-Third/prismriver/internal/app/storage"
 )
 
+// trimPollInterval is how often the Player checks whether a QueueItem has reached its end time or a segment to skip.
+const trimPollInterval = 250 * time.Millisecond
+
 var playerInstance *Player
 var playerOnce sync.Once
 var playerTicker *time.Ticker
@@ -36,15 +42,23 @@ type Player struct {
 	sync.RWMutex
 
 	doneChan chan struct{}
-	player   *vlc.Player
-	State    int
-	Update   chan []byte
-	Volume   int
+	// paused is how long the current item has been paused for, not counting since pausedAt if it's paused right now.
+	paused      time.Duration
+	pausedAt    time.Time
+	player      *vlc.Player
+	restriction *Restriction
+	State       int
+	// stopping is set when the Player is stopped while loading, so that the item being loaded starts out paused.
+	stopping bool
+	Update      chan []byte
+	Volume      int
 }
 
 // State represents status information about the Player, such as the time, state, and volume.
 type State struct {
 	CurrentTime int
+	// Restriction is the restriction of the current quiet hours, or nil outside of quiet hours.
+	Restriction *Restriction
 	TotalTime   int
 	State       int
 	Volume      int
@@ -62,6 +76,9 @@ func GetPlayer() *Player {
 		playerTicker = time.NewTicker(30 * time.Second)
 		go func() {
 			for range playerTicker.C{
+				playerInstance.Lock()
+				playerInstance.enforceQuietHours()
+				playerInstance.Unlock()
 				response, err := playerInstance.generateResponse()
 				if err != nil {
 					logrus.Errorf("could not generate player response: %v", err)
@@ -76,7 +93,7 @@ func GetPlayer() *Player {
 
 // generateResponse generates a JSON response representing the Player's current status.
 func (p *Player) generateResponse() ([]byte, error) {
-	if p.State == PLAYING {
+	if p.State == PLAYING || p.State == PAUSED {
 		currentTime, err := p.player.MediaTime()
 		if err != nil {
 			return nil, err
@@ -87,6 +104,7 @@ func (p *Player) generateResponse() ([]byte, error) {
 		}
 		response, err := json.Marshal(State{
 			CurrentTime: currentTime,
+			Restriction: p.restriction,
 			State:       p.State,
 			TotalTime:   totalTime,
 			Volume:      p.Volume,
@@ -99,6 +117,7 @@ func (p *Player) generateResponse() ([]byte, error) {
 
 	response, err := json.Marshal(State{
 		CurrentTime: 0,
+		Restriction: p.restriction,
 		State:       p.State,
 		TotalTime:   0,
 		Volume:      p.Volume,
@@ -125,28 +144,62 @@ func (p *Player) Play(item *QueueItem) error {
 	defer func() {
 		p.Lock()
 		p.State = STOPPED
+		p.stopping = false
 		p.sendPlayerUpdate()
 		p.Unlock()
 		p.doneChan <- struct{}{}
 	}()
 	p.Lock()
 	p.State = LOADING
+	p.enforceQuietHours()
 	p.Unlock()
-	dataDir := viper.GetString(constants.DATA)
-	ext := ".opus"
-	if item.Media.Video {
-		if viper.GetBool(constants.VIDEO_TRANSCODING) {
-			ext = ".mp4"
-		} else {
-			ext = ".video"
-		}
+	// A nil channel is never ready, so the partial file is ignored unless progressive playback is possible.
+	var partial chan struct{}
+	download := item.queue.download(item)
+	if download != nil && viper.GetBool(constants.PROGRESSIVE_PLAYBACK) {
+		partial = download.partialCh
 	}
-	filePath := path.Join(dataDir, item.Media.Type, item.Media.ID+ext)
+	progressive := false
 	select {
 	case <-item.ctx.Done():
 		logrus.Infof("context canceled, not playing media")
 		return nil
 	case <-item.ready:
+	case <-partial:
+		// The finished file is preferred if it happens to be ready as well.
+		select {
+		case <-item.ready:
+		default:
+			progressive = true
+		}
+	}
+	// Quiet hours may have started since the item was queued, or while it was downloading.
+	if err := CheckQuietHours(item.Media, item.start, item.end); err != nil {
+		logrus.Infof("skipping %v: %v", item.Media.Title, err)
+		return nil
+	}
+	var source string
+	if progressive {
+		var err error
+		if source, err = serveProgressive(item.ctx, download.partial, download.doneCh); err != nil {
+			logrus.Errorf("could not serve partial file for %v: %v", item.Media.Title, err)
+			return err
+		}
+		logrus.Infof("playing %v while it is still being transcoded", item.Media.Title)
+	} else if item.Media.Stream {
+		// Stream URLs tend to expire, so they're resolved right before playing.
+		var err error
+		if source, err = downloader.StreamURL(item.Media); err != nil {
+			logrus.Errorf("could not resolve stream url for %v: %v", item.Media.URL, err)
+			return err
+		}
+	} else {
+		var ok bool
+		if source, ok = storage.Resolve(item.Media); !ok {
+			err := fmt.Errorf("no stored file for media with id %v and type %v", item.Media.ID, item.Media.Type)
+			logrus.Error(err)
+			return err
+		}
 	}
 
 	if err := vlc.Init("--quiet", "--fullscreen"); err != nil {
@@ -178,7 +231,12 @@ func (p *Player) Play(item *QueueItem) error {
 		}
 	}()
 
-	vlcMedia, err := p.player.LoadMediaFromPath(filePath)
+	var vlcMedia *vlc.Media
+	if item.Media.Stream || progressive {
+		vlcMedia, err = p.player.LoadMediaFromURL(source)
+	} else {
+		vlcMedia, err = p.player.LoadMediaFromPath(source)
+	}
 	if err != nil {
 		logrus.Error("Error loading media file:")
 		logrus.Error(err)
@@ -192,6 +250,9 @@ func (p *Player) Play(item *QueueItem) error {
 
 	p.Lock()
 	p.State = PLAYING
+	p.paused = 0
+	stopping := p.stopping
+	p.stopping = false
 	p.Unlock()
 
 	if err := p.player.Play(); err != nil {
@@ -199,6 +260,16 @@ func (p *Player) Play(item *QueueItem) error {
 		logrus.Error(err)
 		return err
 	}
+	if stopping {
+		logrus.Infof("player was stopped while loading %v, pausing it", item.Media.Title)
+		if err := p.Pause(true); err != nil {
+			logrus.Errorf("error pausing player: %v", err)
+		}
+	}
+
+	if item.Media.Type != "internal" {
+		defer p.recordPlay(item, time.Now())
+	}
 
 	p.RLock()
 	if err := p.player.SetVolume(p.Volume); err != nil {
@@ -219,11 +290,18 @@ func (p *Player) Play(item *QueueItem) error {
 		return err
 	}
 
+	// Seeking to the start of a trimmed item has to wait until playback begins, and vlc functions can't be called from
+	// within event callbacks.
+	playing := make(chan struct{}, 1)
 	// play() does not guarantee that metadata will be available, so we wait for mediaplayerplaying instead
 	eventID, err := eventManager.Attach(vlc.MediaPlayerPlaying, func(event vlc.Event, userData interface{}) {
 		p.RLock()
 		p.sendPlayerUpdate()
 		p.RUnlock()
+		select {
+		case playing <- struct{}{}:
+		default:
+		}
 	}, nil)
 	if err != nil {
 		logrus.Errorf("error registering mediaplayerplaying event: %v", err)
@@ -240,24 +318,116 @@ func (p *Player) Play(item *QueueItem) error {
 	}
 	defer eventManager.Detach(eventID)
 
-	<-item.ctx.Done()
-	return nil
+	if item.Media.Stream {
+		// Streams never end on their own, so they're cut off to give everything else in the Queue a turn.
+		timer := time.AfterFunc(viper.GetDuration(constants.STREAM_MAX_DURATION), func() {
+			logrus.Infof("reached maximum play time of stream %v", item.Media.Title)
+			item.cancel()
+		})
+		defer timer.Stop()
+	}
+
+	var segments []db.Segment
+	if categories := viper.GetStringSlice(constants.SKIP_SEGMENT_CATEGORIES); len(categories) > 0 &&
+		item.Media.Type != "internal" {
+		if segments, err = db.GetSegments(item.Media, categories...); err != nil {
+			logrus.Errorf("could not load segments of %v, playing them instead: %v", item.Media.Title, err)
+		}
+	}
+	if item.start == 0 && item.end == 0 && len(segments) == 0 {
+		<-item.ctx.Done()
+		return nil
+	}
+	start := milliseconds(item.start)
+	end := milliseconds(item.end)
+	ticker := time.NewTicker(trimPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-item.ctx.Done():
+			return nil
+		case <-playing:
+			if start > 0 {
+				if err := p.Seek(start); err != nil {
+					logrus.Errorf("error seeking to start of %v: %v", item.Media.Title, err)
+				}
+				start = 0
+			}
+		case <-ticker.C:
+			current, err := p.player.MediaTime()
+			if err != nil {
+				continue
+			}
+			if end > 0 && current >= end {
+				logrus.Debugf("reached end time of %v", item.Media.Title)
+				item.cancel()
+				continue
+			}
+			for _, segment := range segments {
+				segmentStart := milliseconds(segment.StartTime)
+				segmentEnd := milliseconds(segment.EndTime)
+				if current < segmentStart || current >= segmentEnd {
+					continue
+				}
+				logrus.Debugf("skipping %v segment of %v", segment.Category, item.Media.Title)
+				if end > 0 && segmentEnd >= end {
+					item.cancel()
+				} else if err := p.Seek(segmentEnd); err != nil {
+					logrus.Errorf("error skipping segment of %v: %v", item.Media.Title, err)
+				}
+				break
+			}
+		}
+	}
 }
 
-// UpVolume increments the volume of the Player by 5, up to a maximum of 100. UpVolume is thread-safe.
+// recordPlay adds the QueueItem to the play history once it stops playing, with how long it actually played for since
+// started, leaving out any time spent paused.
+func (p *Player) recordPlay(item *QueueItem, started time.Time) {
+	p.RLock()
+	played := time.Since(started) - p.paused
+	if p.State == PAUSED {
+		played -= time.Since(p.pausedAt)
+	}
+	p.RUnlock()
+	// Media.Length is in seconds multiplied by time.Millisecond.
+	length := uint64(played.Seconds() * float64(time.Millisecond))
+	if length > item.length() {
+		length = item.length()
+	}
+	if err := db.AddPlay(item.Media, item.owner, length); err != nil {
+		logrus.Errorf("error recording play history: %v", err)
+		return
+	}
+	resetPlayTotals()
+}
+
+// milliseconds converts a time in the units used by Media.Length into the milliseconds used by vlc. Media.Length is in
+// seconds multiplied by time.Millisecond, which makes it microseconds.
+func milliseconds(length uint64) int {
+	return int(length / uint64(time.Microsecond))
+}
+
+// UpVolume increments the volume of the Player by 5, up to a maximum of 100 or the maximum allowed by the current
+// quiet hours. UpVolume is thread-safe.
 func (p *Player) UpVolume() {
 	p.Lock()
 	defer p.Unlock()
-	if p.Volume == 100 {
+	p.enforceQuietHours()
+	volume := p.Volume + 5
+	if volume > p.maxVolume() {
+		volume = p.maxVolume()
+	}
+	if p.Volume >= volume {
 		return
 	}
 	if p.State == PLAYING {
-		if err := p.player.SetVolume(p.Volume + 5); err != nil {
+		if err := p.player.SetVolume(volume); err != nil {
 			logrus.Errorf("error setting volume: %v", err)
 			return
 		}
 	}
-	p.Volume += 5
+	p.Volume = volume
 	p.sendPlayerUpdate()
 }
 
@@ -278,6 +448,69 @@ func (p *Player) DownVolume() {
 	p.sendPlayerUpdate()
 }
 
+// SetVolume sets the volume of the Player, clamped between 0 and 100 or the maximum allowed by the current quiet
+// hours. SetVolume is thread-safe.
+func (p *Player) SetVolume(volume int) {
+	p.Lock()
+	defer p.Unlock()
+	p.enforceQuietHours()
+	if volume < 0 {
+		volume = 0
+	} else if volume > p.maxVolume() {
+		volume = p.maxVolume()
+	}
+	if p.State == PLAYING || p.State == PAUSED {
+		if err := p.player.SetVolume(volume); err != nil {
+			logrus.Errorf("error setting volume: %v", err)
+			return
+		}
+	}
+	p.Volume = volume
+	p.sendPlayerUpdate()
+}
+
+// Pause pauses or resumes whatever is currently playing. The next item in the Queue always starts playing normally.
+// Pause is thread-safe.
+func (p *Player) Pause(pause bool) error {
+	p.Lock()
+	defer p.Unlock()
+	if pause && p.State != PLAYING {
+		return errors.New("cannot pause player that isn't playing")
+	}
+	if !pause && p.State != PAUSED {
+		return errors.New("cannot resume player that isn't paused")
+	}
+	if err := p.player.SetPause(pause); err != nil {
+		return err
+	}
+	if pause {
+		p.State = PAUSED
+		p.pausedAt = time.Now()
+	} else {
+		p.State = PLAYING
+		p.paused += time.Since(p.pausedAt)
+	}
+	p.sendPlayerUpdate()
+	return nil
+}
+
+// Stop pauses whatever is currently playing. If the next item is still loading, it's paused as soon as it starts
+// playing instead. Unlike Pause, there being nothing to stop isn't an error. Stop is thread-safe.
+func (p *Player) Stop() error {
+	p.Lock()
+	if p.State == LOADING {
+		p.stopping = true
+		p.Unlock()
+		return nil
+	}
+	playing := p.State == PLAYING
+	p.Unlock()
+	if !playing {
+		return nil
+	}
+	return p.Pause(true)
+}
+
 // Seek sets the player to a certain time. Seek is thread-safe.
 func (p *Player) Seek(milliseconds int) error {
 	p.Lock()
@@ -0,0 +1,143 @@
+package player
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+var prefetcherInstance *Prefetcher
+var prefetcherOnce sync.Once
+
+// Prefetcher downloads and transcodes Media that isn't cached yet in the background while the Queue is idle.
+// Media is taken from explicit selections first, then from the most frequently played Media in the play history if
+// automatic prefetching is enabled.
+type Prefetcher struct {
+	sync.Mutex
+
+	pending []db.Media
+}
+
+// GetPrefetcher returns the single Prefetcher instance used by the application.
+func GetPrefetcher() *Prefetcher {
+	prefetcherOnce.Do(func() {
+		prefetcherInstance = &Prefetcher{
+			pending: make([]db.Media, 0),
+		}
+		go prefetcherInstance.run()
+	})
+	return prefetcherInstance
+}
+
+// Add selects a Media item to be prefetched the next time the Queue is idle. Add is thread-safe.
+func (p *Prefetcher) Add(media db.Media) {
+	p.Lock()
+	defer p.Unlock()
+	for _, pending := range p.pending {
+		if pending.ID == media.ID && pending.Type == media.Type && pending.Video == media.Video {
+			return
+		}
+	}
+	p.pending = append(p.pending, media)
+	logrus.Infof("selected media with id %v and type %v for prefetching", media.ID, media.Type)
+}
+
+// run is the main loop of the Prefetcher. Only a single prefetch is run at a time, and only while no downloads for
+// QueueItems are in progress. A running prefetch is stopped as soon as a QueueItem needs to be downloaded.
+func (p *Prefetcher) run() {
+	queue := GetQueue()
+	for {
+		time.Sleep(viper.GetDuration(constants.PREFETCH_INTERVAL))
+
+		queue.RLock()
+		busy := queue.downloading()
+		queue.RUnlock()
+		if busy {
+			logrus.Debug("queue is downloading media, skipping prefetch")
+			continue
+		}
+
+		media, ok := p.next()
+		if !ok {
+			continue
+		}
+		download, ok := queue.prefetch(media)
+		if !ok {
+			continue
+		}
+		logrus.Infof("prefetching media with id %v and type %v", media.ID, media.Type)
+		<-download.doneCh
+		queue.RLock()
+		canceled := download.canceled
+		queue.RUnlock()
+		if canceled {
+			logrus.Infof("stopped prefetching media with id %v and type %v for a queue download, trying again later",
+				media.ID, media.Type)
+			p.retry(media)
+		} else if download.err != "" {
+			logrus.Warnf("error prefetching media with id %v and type %v: %v", media.ID, media.Type, download.err)
+		}
+	}
+}
+
+// retry puts a Media item whose prefetch was stopped back at the front of the selections. retry is thread-safe.
+func (p *Prefetcher) retry(media db.Media) {
+	p.Lock()
+	defer p.Unlock()
+	p.pending = append([]db.Media{media}, p.pending...)
+}
+
+// next returns the next Media item that should be prefetched, if any.
+func (p *Prefetcher) next() (db.Media, bool) {
+	p.Lock()
+	for len(p.pending) > 0 {
+		media := p.pending[0]
+		p.pending = p.pending[1:]
+		if !media.Stream && !isCached(media) {
+			p.Unlock()
+			return media, true
+		}
+	}
+	p.Unlock()
+
+	if !viper.GetBool(constants.PREFETCH) {
+		return db.Media{}, false
+	}
+	popular, err := db.GetPopularMedia(viper.GetInt(constants.PREFETCH_LIMIT))
+	if err != nil {
+		logrus.Errorf("could not retrieve play history for prefetching: %v", err)
+		return db.Media{}, false
+	}
+	for _, media := range popular {
+		if !media.Stream && !isCached(media) {
+			return media, true
+		}
+	}
+	return db.Media{}, false
+}
+
+// prefetch starts a background download of the given Media if it isn't cached or already being downloaded, and the
+// Queue isn't downloading anything else. prefetch is thread-safe.
+func (q *Queue) prefetch(media db.Media) (*Download, bool) {
+	q.Lock()
+	defer q.Unlock()
+	key := DownloadKey{
+		id:        media.ID,
+		mediaType: media.Type,
+		video:     media.Video,
+	}
+	if _, ok := q.downloads[key]; ok || media.Stream || q.downloading() || isCached(media) {
+		return nil, false
+	}
+	download, err := q.startDownload(media, key, true)
+	if err != nil {
+		logrus.Errorf("error when prefetching media: %v", err)
+		return nil, false
+	}
+	return download, true
+}
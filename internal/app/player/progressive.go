@@ -0,0 +1,90 @@
+package player
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// progressivePollInterval is how long to wait for more of a partial file to be written after catching up to it.
+const progressivePollInterval = 250 * time.Millisecond
+
+// growingReader reads a file that is still being written, waiting for more data at the end of the file until done is
+// closed.
+type growingReader struct {
+	ctx  context.Context
+	done <-chan struct{}
+	file *os.File
+}
+
+// Read implements io.Reader, only returning io.EOF once the file is complete.
+func (g *growingReader) Read(p []byte) (int, error) {
+	for {
+		n, err := g.file.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		select {
+		case <-g.done:
+			// Anything written between the last read and finishing the file still needs to be read.
+			return g.file.Read(p)
+		case <-g.ctx.Done():
+			return 0, g.ctx.Err()
+		case <-time.After(progressivePollInterval):
+		}
+	}
+}
+
+// serveProgressive serves the partial file at filePath over HTTP on the loopback interface until ctx is canceled and
+// returns its URL. VLC can only play files from disk once they're complete, but it plays URLs as streams, so this lets
+// it start on a file that is still being transcoded.
+func serveProgressive(ctx context.Context, filePath string, done <-chan struct{}) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			file, err := os.Open(filePath)
+			if err != nil {
+				message := fmt.Sprintf("could not open partial file %v: %v", filePath, err)
+				logrus.Errorf(message)
+				http.Error(w, message, http.StatusNotFound)
+				return
+			}
+			defer func() {
+				if err := file.Close(); err != nil {
+					logrus.Errorf("error closing partial file: %v", err)
+				}
+			}()
+			w.Header().Set("Content-Type", "application/octet-stream")
+			reader := &growingReader{
+				ctx:  r.Context(),
+				done: done,
+				file: file,
+			}
+			if _, err := io.Copy(w, reader); err != nil {
+				logrus.Debugf("stopped serving partial file %v: %v", filePath, err)
+			}
+		}),
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logrus.Errorf("error serving partial file %v: %v", filePath, err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		if err := server.Close(); err != nil {
+			logrus.Errorf("error closing partial file server: %v", err)
+		}
+	}()
+	return fmt.Sprintf("http://%v/%v", listener.Addr(), path.Base(filePath)), nil
+}
@@ -3,27 +3,42 @@ package player
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"math/rand"
-	"os"
-	"path"
 	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
 	"github.com/Safety-Third/prismriver/internal/app/constants"
 	"github.com/Safety-Third/prismriver/internal/app/db"
 	"github.com/Safety-Third/prismriver/internal/app/downloader"
+	"github.com/Safety-Third/prismriver/internal/app/storage"
 )
 
 var queueInstance *Queue
 var queueOnce sync.Once
 
+// ErrNoBumpCredits is returned when an owner tries to bump a QueueItem after using up their credits for the hour.
+var ErrNoBumpCredits = errors.New("no bump credits left, try again later")
+
+// ErrNotOwner is returned when trying to bump somebody else's QueueItem.
+var ErrNotOwner = errors.New("only the owner of a queue item can bump it")
+
 // Download represents a download occurring for a QueueItem.
 type Download struct {
-	doneCh   chan struct{}
-	err      string
-	progress int
+	// cancel stops the download, which is only done to prefetches once a QueueItem needs downloading.
+	cancel    context.CancelFunc
+	canceled  bool
+	doneCh    chan struct{}
+	err       string
+	// partial is the path of the file being transcoded, which is set before partialCh is closed.
+	partial   string
+	partialCh chan struct{}
+	prefetch  bool
+	progress  int
 }
 
 // DownloadKey represents a identifier for a specific Download via its id, type, and video status.
@@ -37,17 +52,25 @@ type DownloadKey struct {
 type Queue struct {
 	sync.RWMutex
 
-	balancing bool
+	// bumps holds the times that each owner bumped one of their QueueItems within the last hour.
+	bumps     map[uint32][]time.Time
 	downloads map[DownloadKey]*Download
+	// history holds snapshots of the Queue from before recent operations, newest last, so that they can be undone.
+	history   []snapshot
 	items     []*QueueItem
+	// ordering is the name of the OrderingStrategy used to insert new QueueItems.
+	ordering  string
 	Update    chan []byte
 }
 
 // QueueItem represents a Media item waiting to be played in the Queue.
 type QueueItem struct {
+	// balanced is unset for QueueItems that were moved manually, which the OrderingStrategy leaves alone.
 	balanced bool
 	cancel   context.CancelFunc
 	ctx      context.Context
+	// end and start limit playback of the QueueItem, defaulting to those of its Media.
+	end      uint64
 	err      string
 	// go doesn't have a method for returning a random generic uint for some reason
 	id       uint32
@@ -55,31 +78,47 @@ type QueueItem struct {
 	owner    uint32
 	ready    chan struct{}
 	queue    *Queue
+	// removed is set for QueueItems that were removed or skipped, which are added back when undoing.
+	removed  bool
+	start    uint64
 }
 
 // QueueResponse represents a Queue containing the necessary fields to be exported via JSON.
 type QueueResponse struct {
+	// Balancing is kept for older clients and is set for any ordering other than ORDERING_FIFO.
 	Balancing bool                `json:"balancing"`
 	Items     []QueueItemResponse `json:"items"`
+	Ordering  string              `json:"ordering"`
+	Orderings []string            `json:"orderings"`
+	// Undo is the name of the operation that would be undone next, if there is one.
+	Undo      string              `json:"undo"`
 }
 
 // QueueItemResponse represents a QueueItem containing the necessary fields to be exported via JSON.
 type QueueItemResponse struct {
 	Downloading bool     `json:"downloading"`
+	End         uint64   `json:"end"`
 	Error       string   `json:"error"`
 	Id          uint32   `json:"id"`
 	Media       db.Media `json:"media"`
 	Progress    int      `json:"progress"`
+	Start       uint64   `json:"start"`
 }
 
 // GetQueue returns the single Queue instance of the application.
 func GetQueue() *Queue {
 	queueOnce.Do(func() {
 		logrus.Info("Created queue instance.")
+		ordering := viper.GetString(constants.QUEUE_ORDERING)
+		if _, err := GetOrderingStrategy(ordering); err != nil {
+			logrus.Warnf("%v, using %v instead", err, ORDERING_BALANCED)
+			ordering = ORDERING_BALANCED
+		}
 		queueInstance = &Queue{
-			balancing: true,
+			bumps:     make(map[uint32][]time.Time),
 			downloads: make(map[DownloadKey]*Download),
 			items:     make([]*QueueItem, 0),
+			ordering:  ordering,
 			Update:    make(chan []byte),
 		}
 		go func() {
@@ -95,94 +134,174 @@ func GetQueue() *Queue {
 // Add adds a new Media item to the Queue as a QueueItem. If the item is detected to not be ready, it will instantiate
 // a download of the Media. Add is thread-safe.
 func (q *Queue) Add(media db.Media, owner uint32) {
+	q.AddTrimmed(media, owner, media.StartTime, media.EndTime)
+}
+
+// AddTrimmed adds a new Media item to the Queue like Add, but only plays it between start and end instead of the
+// defaults of the Media. AddTrimmed is thread-safe.
+func (q *Queue) AddTrimmed(media db.Media, owner uint32, start uint64, end uint64) {
+	q.Lock()
+	defer q.Unlock()
+	item := q.newQueueItem(media, owner)
+	item.start = start
+	item.end = end
+	q.items = q.strategy().Insert(item, q.items)
+	if err := q.prepare(item); err != nil {
+		logrus.Errorf("error when downloading media: %v", err)
+		return
+	}
+	player := GetPlayer()
+	if player.State == STOPPED && len(q.items) == 1 {
+		go player.Play(item)
+	}
+	q.sendQueueUpdate()
+	logrus.Info("Added " + media.Title + " to queue.")
+}
+
+// AddNext adds a new Media item to the Queue right after the currently playing item, where it's left alone by the
+// OrderingStrategy like an item moved with PlayNext. AddNext is thread-safe.
+func (q *Queue) AddNext(media db.Media, owner uint32) {
 	q.Lock()
 	defer q.Unlock()
 	item := q.newQueueItem(media, owner)
-	if q.balancing {
-		q.items = InsertQueueItemBalanced(item, q.items)
+	item.balanced = false
+	if len(q.items) == 0 {
+		q.items = append(q.items, item)
 	} else {
-		q.items = InsertQueueItemDefault(item, q.items)
+		q.items = append(q.items[:1], append([]*QueueItem{item}, q.items[1:]...)...)
+	}
+	if err := q.prepare(item); err != nil {
+		logrus.Errorf("error when downloading media: %v", err)
+		return
 	}
+	player := GetPlayer()
+	if player.State == STOPPED && len(q.items) == 1 {
+		go player.Play(item)
+	}
+	q.sendQueueUpdate()
+	logrus.Infof("added %v to the top of the queue", media.Title)
+}
 
-	dataDir := viper.GetString(constants.DATA)
-	ext := ".opus"
-	if media.Video {
-		if viper.GetBool(constants.VIDEO_TRANSCODING) {
-			ext = ".mp4"
-		} else {
-			ext = ".video"
+// CheckAllowed returns a downloader.RejectionError if the given Media can't be queued to play between start and end,
+// because it's blocked, breaks the rules for its type or isn't allowed during the current quiet hours. Every way of
+// adding Media to the Queue on behalf of somebody goes through CheckAllowed first.
+func CheckAllowed(media db.Media, start uint64, end uint64) error {
+	block, blocked, err := db.FindBlock(media)
+	if err != nil {
+		return errors.Wrap(err, "could not check blocklist")
+	}
+	if blocked {
+		reason := fmt.Sprintf("%v is blocked", media.Title)
+		if block.Reason != "" {
+			reason = fmt.Sprintf("%v: %v", reason, block.Reason)
 		}
+		return downloader.RejectionError{Reason: reason}
 	}
-	filePath := path.Join(dataDir, media.Type, media.ID+ext)
-	_, err := os.Stat(filePath)
+	if err := downloader.ValidateMedia(media, start, end); err != nil {
+		return err
+	}
+	return CheckQuietHours(media, start, end)
+}
+
+// prepare gets a new QueueItem ready to be played, downloading its Media first if needed. The caller must hold the
+// Queue's lock.
+func (q *Queue) prepare(item *QueueItem) error {
 	key := DownloadKey{
 		id:        item.Media.ID,
 		mediaType: item.Media.Type,
 		video:     item.Media.Video,
 	}
 	download, ok := q.downloads[key]
-	if item.Media.Type != "internal" && (os.IsNotExist(err) || ok) {
-		if ok {
-			go func() {
-				<-download.doneCh
-				if download.err != "" {
-					q.Lock()
-					defer q.Unlock()
-					item.err = download.err
-					q.sendQueueUpdate()
-					return
-				}
-				close(item.ready)
-			}()
-		} else {
-			download := &Download{
-				doneCh: make(chan struct{}),
-			}
-			q.downloads[key] = download
-
-			progressChan, doneChan, err := downloader.DownloadMedia(media)
+	// Streams are played straight from their source, so they're always ready.
+	if item.Media.Type != "internal" && !item.Media.Stream && (!isCached(item.Media) || ok) {
+		if !ok {
+			// Prefetches would only slow down downloads that somebody is actually waiting on.
+			q.cancelPrefetches()
+			var err error
+			download, err = q.startDownload(item.Media, key, false)
 			if err != nil {
-				logrus.Errorf("error when downloading media: %v", err)
-				return
+				return err
 			}
-
-			go func() {
-				for progress := range progressChan {
-					q.Lock()
-					download.progress = int(progress)
-					q.sendQueueUpdate()
-					q.Unlock()
-				}
-				if err := <-doneChan; err != nil {
-					q.Lock()
-					defer q.Unlock()
-					download.err = err.Error()
-					item.err = err.Error()
-					delete(q.downloads, key)
-					close(download.doneCh)
-					q.sendQueueUpdate()
-					return
-				}
+		} else {
+			// A prefetch that a QueueItem is waiting on is no longer just a prefetch.
+			download.prefetch = false
+		}
+		go func() {
+			<-download.doneCh
+			if download.err != "" {
 				q.Lock()
-				delete(q.downloads, key)
-				close(download.doneCh)
+				defer q.Unlock()
+				item.err = download.err
 				q.sendQueueUpdate()
-				q.Unlock()
-				close(item.ready)
-			}()
-		}
+				return
+			}
+			close(item.ready)
+		}()
 	} else {
 		logrus.Debugf("queue item %v ready", item.id)
 		go func() {
 			close(item.ready)
 		}()
 	}
-	player := GetPlayer()
-	if player.State == STOPPED && len(q.items) == 1 {
-		go player.Play(item)
+	return nil
+}
+
+// startDownload begins a download of the given Media and registers it in the Queue's downloads under key so that it
+// can be shared by any QueueItems for the same Media. The caller must hold the Queue's lock.
+func (q *Queue) startDownload(media db.Media, key DownloadKey, prefetch bool) (*Download, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	progressChan, partialChan, doneChan, err := downloader.DownloadMedia(ctx, media)
+	if err != nil {
+		cancel()
+		return nil, err
 	}
-	q.sendQueueUpdate()
-	logrus.Info("Added " + media.Title + " to queue.")
+	download := &Download{
+		cancel:    cancel,
+		doneCh:    make(chan struct{}),
+		partialCh: make(chan struct{}),
+		prefetch:  prefetch,
+	}
+	q.downloads[key] = download
+
+	go func() {
+		for partial := range partialChan {
+			q.Lock()
+			download.partial = partial
+			close(download.partialCh)
+			q.Unlock()
+		}
+	}()
+
+	go func() {
+		for progress := range progressChan {
+			q.Lock()
+			download.progress = int(progress)
+			q.sendQueueUpdate()
+			q.Unlock()
+		}
+		err := <-doneChan
+		if err == nil {
+			err = storage.Record(media, downloader.FilePath(media), downloader.GetProfileName(media.Video))
+		}
+		if err == nil {
+			go func() {
+				if err := storage.CacheThumbnail(media); err != nil {
+					logrus.Warnf("could not cache thumbnail for media with id %v and type %v: %v", media.ID,
+						media.Type, err)
+				}
+			}()
+		}
+		cancel()
+		q.Lock()
+		defer q.Unlock()
+		if err != nil {
+			download.err = err.Error()
+		}
+		delete(q.downloads, key)
+		close(download.doneCh)
+		q.sendQueueUpdate()
+	}()
+	return download, nil
 }
 
 // Advance moves the Queue up by one and plays the next item if it exists. Advance is thread-safe.
@@ -197,12 +316,15 @@ func (q *Queue) Advance() {
 	q.sendQueueUpdate()
 }
 
-// BeQuiet replaces the currently playing item with the BeQuiet Media and plays it. BeQuiet is thread-safe.
-func (q *Queue) BeQuiet() {
+// BeQuiet replaces the currently playing item with the given announcement, which is usually db.BeQuiet, and plays
+// it. BeQuiet is thread-safe.
+func (q *Queue) BeQuiet(announcement db.Media) {
 	q.Lock()
 	defer q.Unlock()
-	item := q.newQueueItem(*db.BeQuiet, 0)
+	q.remember(UNDO_BE_QUIET)
+	item := q.newQueueItem(announcement, 0)
 	close(item.ready)
+	q.history[len(q.history)-1].announcement = item
 	old := q.items
 	q.items = make([]*QueueItem, 0)
 	if len(old) == 0 {
@@ -212,6 +334,7 @@ func (q *Queue) BeQuiet() {
 	} else {
 		q.items = append(q.items, old[0], item)
 		q.items = append(q.items, old[1:]...)
+		q.items[0].removed = true
 		q.items[0].cancel()
 	}
 	q.sendQueueUpdate()
@@ -228,6 +351,83 @@ func (q *Queue) List() ([]byte, error) {
 	return response, nil
 }
 
+// PlayNext moves a QueueItem to right after the currently playing item, where it's left alone by the OrderingStrategy.
+// PlayNext is thread-safe.
+func (q *Queue) PlayNext(index int) error {
+	q.Lock()
+	defer q.Unlock()
+	if index == 0 || index >= len(q.items) {
+		return errors.Errorf("no waiting queue item at index %v", index)
+	}
+	q.remember(UNDO_MOVE)
+	item := q.items[index]
+	q.items = append(q.items[:index], q.items[index+1:]...)
+	q.items = append(q.items[:1], append([]*QueueItem{item}, q.items[1:]...)...)
+	item.balanced = false
+	logrus.Infof("playing %v next", item.Media.Title)
+	q.sendQueueUpdate()
+	return nil
+}
+
+// Bump spends one of owner's bump credits to move their QueueItem at index into the place of their first waiting
+// QueueItem, moving their other items back by one place. Only owner's own items change places, so everybody else keeps
+// their place in the Queue. Bump returns how many credits owner has left within the hour. Undoing a bump doesn't give
+// the credit back. Bump is thread-safe.
+func (q *Queue) Bump(index int, owner uint32) (int, error) {
+	q.Lock()
+	defer q.Unlock()
+	if index == 0 || index >= len(q.items) {
+		return 0, errors.Errorf("no waiting queue item at index %v", index)
+	}
+	if q.items[index].owner != owner {
+		return 0, ErrNotOwner
+	}
+	credits := q.credits(owner)
+	if credits == 0 {
+		return 0, ErrNoBumpCredits
+	}
+	if !q.items[index].balanced {
+		return credits, errors.New("queue items that were moved manually cannot be bumped")
+	}
+	slots := make([]int, 0)
+	for i := 1; i <= index; i++ {
+		if q.items[i].owner == owner && q.items[i].balanced {
+			slots = append(slots, i)
+		}
+	}
+	if len(slots) < 2 {
+		return credits, errors.New("queue item is already the next one of its owner")
+	}
+	q.remember(UNDO_BUMP)
+	for i := len(slots) - 1; i > 0; i-- {
+		q.items[slots[i]], q.items[slots[i-1]] = q.items[slots[i-1]], q.items[slots[i]]
+	}
+	q.bumps[owner] = append(q.bumps[owner], time.Now())
+	logrus.Infof("bumped %v", q.items[slots[0]].Media.Title)
+	q.sendQueueUpdate()
+	return credits - 1, nil
+}
+
+// credits returns how many bump credits owner has left within the hour, forgetting any bumps older than that. The
+// caller must hold the Queue's lock.
+func (q *Queue) credits(owner uint32) int {
+	recent := make([]time.Time, 0)
+	for _, bumped := range q.bumps[owner] {
+		if time.Since(bumped) < time.Hour {
+			recent = append(recent, bumped)
+		}
+	}
+	q.bumps[owner] = recent
+	if len(recent) == 0 {
+		delete(q.bumps, owner)
+	}
+	credits := viper.GetInt(constants.BUMP_CREDITS) - len(recent)
+	if credits < 0 {
+		return 0
+	}
+	return credits
+}
+
 // MoveTo moves a QueueItem to a specific position in the Queue. MoveTo is thread-safe.
 func (q *Queue) MoveTo(index int, to int) {
 	q.Lock()
@@ -239,6 +439,7 @@ func (q *Queue) MoveTo(index int, to int) {
 		return
 	}
 	if index < len(q.items) && to < len(q.items) {
+		q.remember(UNDO_MOVE)
 		item := q.items[index]
 		q.items = append(q.items[:index], q.items[index + 1:]...)
 		if to == len(q.items) {
@@ -262,8 +463,13 @@ func (q *Queue) generateResponse() ([]byte, error) {
 		items = append(items, item.generateResponse())
 	}
 	wrapper := QueueResponse{
-		Balancing: q.balancing,
+		Balancing: q.ordering != ORDERING_FIFO,
 		Items:     items,
+		Ordering:  q.ordering,
+		Orderings: GetOrderingStrategies(),
+	}
+	if len(q.history) > 0 {
+		wrapper.Undo = q.history[len(q.history)-1].operation
 	}
 	response, err := json.Marshal(wrapper)
 	if err != nil {
@@ -278,6 +484,8 @@ func (q *Queue) Remove(index int) {
 	q.Lock()
 	defer q.Unlock()
 	if index < len(q.items) {
+		q.remember(UNDO_REMOVE)
+		q.items[index].removed = true
 		q.items[index].cancel()
 		if index == 0 {
 			return
@@ -291,24 +499,155 @@ func (q *Queue) Remove(index int) {
 	}
 }
 
-// SetBalancing turns on and off balancing queue ordering. SetBalancing is thread-safe.
-func (q *Queue) SetBalancing(balancing bool) {
+// Clear removes every QueueItem from the Queue, stopping the currently playing item. Clear is thread-safe.
+func (q *Queue) Clear() {
 	q.Lock()
 	defer q.Unlock()
-	q.balancing = balancing
-	if q.balancing {
-		orderedItems := make([]*QueueItem, 0)
-		for _, item := range q.items {
+	if len(q.items) == 0 {
+		return
+	}
+	q.remember(UNDO_CLEAR)
+	for _, item := range q.items {
+		item.removed = true
+		item.cancel()
+	}
+	// The currently playing item is removed by Advance once the player stops.
+	q.items = q.items[:1]
+	logrus.Info("cleared queue")
+	q.sendQueueUpdate()
+}
+
+// RemoveMatching removes every QueueItem whose Media matches and returns how many were removed. If the currently
+// playing item matches, it's canceled, which stops playback and removes it once the player stops. RemoveMatching is
+// thread-safe.
+func (q *Queue) RemoveMatching(matches func(media db.Media) bool) int {
+	q.Lock()
+	defer q.Unlock()
+	removed := 0
+	remaining := make([]*QueueItem, 0)
+	for i, item := range q.items {
+		if !matches(item.Media) {
+			remaining = append(remaining, item)
+			continue
+		}
+		item.cancel()
+		removed++
+		// The currently playing item is removed by Advance once the player stops.
+		if i == 0 {
+			remaining = append(remaining, item)
+		}
+	}
+	q.items = remaining
+	if removed > 0 {
+		logrus.Infof("removed %v matching items from queue", removed)
+		q.sendQueueUpdate()
+	}
+	return removed
+}
+
+// Get returns the QueueItem at index in its exported form, or false if there isn't one. Get is thread-safe.
+func (q *Queue) Get(index int) (QueueItemResponse, bool) {
+	q.RLock()
+	defer q.RUnlock()
+	if index < 0 || index >= len(q.items) {
+		return QueueItemResponse{}, false
+	}
+	return q.items[index].generateResponse(), true
+}
+
+// SetTrim changes where the QueueItem at index starts and ends playback. The currently playing item cannot be
+// changed. SetTrim is thread-safe.
+func (q *Queue) SetTrim(index int, start uint64, end uint64) error {
+	q.Lock()
+	defer q.Unlock()
+	if index == 0 || index >= len(q.items) {
+		return errors.Errorf("no waiting queue item at index %v", index)
+	}
+	item := q.items[index]
+	if err := item.Media.ValidateTrim(start, end); err != nil {
+		return err
+	}
+	item.start = start
+	item.end = end
+	q.sendQueueUpdate()
+	return nil
+}
+
+// SetOrdering switches to the OrderingStrategy registered under the given name and reorders the QueueItems with it,
+// including any that were moved manually. The currently playing item stays first. SetOrdering is thread-safe.
+func (q *Queue) SetOrdering(name string) error {
+	strategy, err := GetOrderingStrategy(name)
+	if err != nil {
+		return err
+	}
+	q.Lock()
+	defer q.Unlock()
+	q.remember(UNDO_ORDERING)
+	q.ordering = name
+	if len(q.items) > 0 {
+		orderedItems := []*QueueItem{q.items[0]}
+		for _, item := range q.items[1:] {
 			item.balanced = true
-			orderedItems = InsertQueueItemBalanced(item, orderedItems)
+			orderedItems = strategy.Insert(item, orderedItems)
 		}
 		q.items = orderedItems
-	} else {
-		for _, item := range q.items {
-			item.balanced = false
-		}
 	}
 	q.sendQueueUpdate()
+	return nil
+}
+
+// strategy returns the OrderingStrategy currently in use, falling back to ORDERING_FIFO if it's no longer
+// registered.
+func (q *Queue) strategy() OrderingStrategy {
+	strategy, err := GetOrderingStrategy(q.ordering)
+	if err != nil {
+		return OrderingStrategyFunc(InsertQueueItemDefault)
+	}
+	return strategy
+}
+
+// Has returns whether or not the given Media is currently playing or waiting in the Queue. Has is thread-safe.
+func (q *Queue) Has(media db.Media) bool {
+	q.RLock()
+	defer q.RUnlock()
+	for _, item := range q.items {
+		if item.Media.ID == media.ID && item.Media.Type == media.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// download returns the Download in progress for the given QueueItem, or nil if it isn't being downloaded. download is
+// thread-safe.
+func (q *Queue) download(item *QueueItem) *Download {
+	q.RLock()
+	defer q.RUnlock()
+	return q.downloads[DownloadKey{
+		id:        item.Media.ID,
+		mediaType: item.Media.Type,
+		video:     item.Media.Video,
+	}]
+}
+
+// cancelPrefetches stops every prefetch that is currently running. The caller must hold the Queue's lock.
+func (q *Queue) cancelPrefetches() {
+	for _, download := range q.downloads {
+		if download.prefetch && !download.canceled {
+			download.canceled = true
+			download.cancel()
+		}
+	}
+}
+
+// downloading returns whether or not any downloads for QueueItems are currently in progress, ignoring prefetches.
+func (q *Queue) downloading() bool {
+	for _, download := range q.downloads {
+		if !download.prefetch {
+			return true
+		}
+	}
+	return false
 }
 
 func (q *Queue) contains(id uint32) bool {
@@ -336,29 +675,44 @@ func (q *Queue) newQueueItem(media db.Media, owner uint32) *QueueItem {
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	return &QueueItem{
-		balanced: q.balancing,
+		balanced: true,
 		cancel: cancel,
 		ctx: ctx,
+		end: media.EndTime,
 		id: id,
 		Media: media,
 		owner: owner,
 		ready: make(chan struct{}),
 		queue: q,
+		start: media.StartTime,
 	}
 }
 
+// isCached returns whether or not a stored file for the given Media already exists.
+func isCached(media db.Media) bool {
+	_, ok := storage.Resolve(media)
+	return ok
+}
+
 // generateResponse returns the QueueItemResponse form of the QueueItem.
 func (q QueueItem) generateResponse() QueueItemResponse {
 	downloading, progress := q.progress()
 	return QueueItemResponse{
 		Downloading: downloading,
+		End:         q.end,
 		Error:       q.err,
 		Id:          q.id,
 		Media:       q.Media,
 		Progress:    progress,
+		Start:       q.start,
 	}
 }
 
+// length returns how long the QueueItem plays for once trimmed, in the same units as Media.Length.
+func (q QueueItem) length() uint64 {
+	return q.Media.Trimmed(q.start, q.end)
+}
+
 // Progress returns the download progress of the QueueItem.
 func (q QueueItem) progress() (bool, int) {
 	key := DownloadKey{
@@ -378,6 +732,7 @@ func (q *Queue) Shuffle() {
 	q.Lock()
 	defer q.Unlock()
 	if len(q.items) > 1 {
+		q.remember(UNDO_SHUFFLE)
 		// Offset by one since we don't want to modify the currently playing item.
 		rand.Shuffle(len(q.items)-1, func(i, j int) {
 			q.items[i+1], q.items[j+1] = q.items[j+1], q.items[i+1]
@@ -0,0 +1,158 @@
+package player
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/downloader"
+)
+
+// QuietHours is a configured window of time during which playback is restricted, such as late at night.
+type QuietHours struct {
+	// Start and End are times of day like 22:00, in local time. Windows that end before they start go past midnight.
+	Start string `mapstructure:"start"`
+	End   string `mapstructure:"end"`
+	// MaxVolume is the highest volume allowed. 0 leaves the volume alone.
+	MaxVolume int `mapstructure:"max_volume"`
+	// MaxLength is the longest Media that can be queued. 0 allows any length.
+	MaxLength   time.Duration `mapstructure:"max_length"`
+	RejectVideo bool          `mapstructure:"reject_video"`
+}
+
+// Restriction represents the restrictions of any quiet hours that are currently active, as exported to clients.
+type Restriction struct {
+	// End is the time of day that the restriction is lifted, like 07:00.
+	End string
+	// MaxLength is the longest Media that can be queued in milliseconds, like TotalTime. 0 allows any length.
+	MaxLength   int
+	MaxVolume   int
+	RejectVideo bool
+}
+
+// active returns whether or not the QuietHours are in effect at the given time.
+func (h QuietHours) active(t time.Time) (bool, error) {
+	start, err := time.Parse("15:04", h.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := time.Parse("15:04", h.End)
+	if err != nil {
+		return false, err
+	}
+	now := t.Hour()*60 + t.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	if from < to {
+		return now >= from && now < to, nil
+	}
+	// Windows past midnight, or the whole day if they start and end at the same time.
+	return now >= from || now < to, nil
+}
+
+// quietHours returns the combined Restriction of every quiet hours window active at the given time, or nil if there
+// are none. When windows overlap, the strictest of each of their restrictions applies.
+func quietHours(t time.Time) *Restriction {
+	var configured []QuietHours
+	if err := viper.UnmarshalKey(constants.QUIET_HOURS, &configured); err != nil {
+		logrus.Errorf("could not parse %v, ignoring: %v", constants.QUIET_HOURS, err)
+		return nil
+	}
+	var restriction *Restriction
+	for _, hours := range configured {
+		active, err := hours.active(t)
+		if err != nil {
+			logrus.Warnf("ignoring quiet hours from %v to %v: %v", hours.Start, hours.End, err)
+			continue
+		}
+		if !active {
+			continue
+		}
+		if restriction == nil {
+			restriction = &Restriction{
+				End:       hours.End,
+				MaxVolume: 100,
+			}
+		}
+		if hours.MaxVolume > 0 && hours.MaxVolume < restriction.MaxVolume {
+			restriction.MaxVolume = hours.MaxVolume
+		}
+		maxLength := int(hours.MaxLength / time.Millisecond)
+		if maxLength > 0 && (restriction.MaxLength == 0 || maxLength < restriction.MaxLength) {
+			restriction.MaxLength = maxLength
+		}
+		restriction.RejectVideo = restriction.RejectVideo || hours.RejectVideo
+	}
+	return restriction
+}
+
+// CheckQuietHours returns a downloader.RejectionError if the given Media can't be queued during the current quiet
+// hours when played between start and end. It's checked again when the Media starts playing, and the Media is skipped
+// if quiet hours that don't allow it have started in the meantime.
+func CheckQuietHours(media db.Media, start uint64, end uint64) error {
+	restriction := quietHours(time.Now())
+	if restriction == nil || media.Type == "internal" {
+		return nil
+	}
+	if restriction.RejectVideo && media.Video {
+		return downloader.RejectionError{
+			Reason: fmt.Sprintf("videos cannot be queued during quiet hours, which end at %v", restriction.End),
+		}
+	}
+	if restriction.MaxLength == 0 {
+		return nil
+	}
+	maxLength := time.Duration(restriction.MaxLength) * time.Millisecond
+	if media.Stream {
+		return downloader.RejectionError{
+			Reason: fmt.Sprintf("streams cannot be queued during quiet hours, which end at %v", restriction.End),
+		}
+	}
+	if length := time.Duration(milliseconds(media.Trimmed(start, end))) * time.Millisecond; length > maxLength {
+		return downloader.RejectionError{
+			Reason: fmt.Sprintf("%v is %v long, longer than the maximum of %v during quiet hours, which end at %v",
+				media.Title, length.Round(time.Second), maxLength, restriction.End),
+		}
+	}
+	return nil
+}
+
+// maxVolume returns the highest volume allowed by the current quiet hours. The caller must hold the Player's lock.
+func (p *Player) maxVolume() int {
+	if p.restriction == nil {
+		return 100
+	}
+	return p.restriction.MaxVolume
+}
+
+// enforceQuietHours updates the Player's Restriction for the current time and lowers the volume if it's above what
+// the Restriction allows. It returns whether or not anything changed. The caller must hold the Player's lock.
+func (p *Player) enforceQuietHours() bool {
+	restriction := quietHours(time.Now())
+	changed := (restriction == nil) != (p.restriction == nil) ||
+		restriction != nil && *restriction != *p.restriction
+	if changed {
+		if restriction != nil {
+			logrus.Infof("quiet hours in effect until %v", restriction.End)
+		} else {
+			logrus.Info("quiet hours over")
+		}
+	}
+	p.restriction = restriction
+	if p.Volume <= p.maxVolume() {
+		return changed
+	}
+	if p.State == PLAYING || p.State == PAUSED {
+		if err := p.player.SetVolume(p.maxVolume()); err != nil {
+			logrus.Errorf("error setting volume: %v", err)
+			return changed
+		}
+	}
+	logrus.Infof("lowered volume from %v to %v for quiet hours", p.Volume, p.maxVolume())
+	p.Volume = p.maxVolume()
+	return true
+}
@@ -0,0 +1,140 @@
+package player
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// undoLimit is how many operations can be undone, after which the oldest are forgotten.
+const undoLimit = 20
+
+// Operations on the Queue that can be undone.
+const (
+	UNDO_BE_QUIET = "be quiet"
+	UNDO_BUMP     = "bump"
+	UNDO_CLEAR    = "clear"
+	UNDO_MOVE     = "move"
+	UNDO_ORDERING = "ordering"
+	UNDO_REMOVE   = "remove"
+	UNDO_SHUFFLE  = "shuffle"
+)
+
+// ErrNothingToUndo is returned when undoing with an empty undo history.
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// snapshot represents the state of the Queue right before an operation, which can be restored to undo it.
+type snapshot struct {
+	// announcement is the QueueItem that was added by UNDO_BE_QUIET, which is stopped or removed when undoing.
+	announcement *QueueItem
+	items        []snapshotItem
+	operation    string
+	ordering     string
+}
+
+// snapshotItem represents a QueueItem and its state at the time of a snapshot.
+type snapshotItem struct {
+	balanced bool
+	item     *QueueItem
+}
+
+// remember records the state of the Queue before the given operation so that it can be undone, forgetting the
+// oldest snapshot if the undo history is full. The caller must hold the Queue's lock.
+func (q *Queue) remember(operation string) {
+	items := make([]snapshotItem, 0, len(q.items))
+	for _, item := range q.items {
+		items = append(items, snapshotItem{
+			balanced: item.balanced,
+			item:     item,
+		})
+	}
+	q.history = append(q.history, snapshot{
+		items:     items,
+		operation: operation,
+		ordering:  q.ordering,
+	})
+	if len(q.history) > undoLimit {
+		q.history = q.history[len(q.history)-undoLimit:]
+	}
+}
+
+// Undo restores the order of the Queue from before the last operation in the undo history. Removed QueueItems are
+// added back as fresh QueueItems, while anything that finished playing since is left out and anything added since is
+// kept. The currently playing item always stays first, except for the announcement of Be Quiet, which is stopped
+// when undoing it. Undo returns the name of the operation that was undone. Undo is thread-safe.
+func (q *Queue) Undo() (string, error) {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.history) == 0 {
+		return "", ErrNothingToUndo
+	}
+	last := q.history[len(q.history)-1]
+	q.history = q.history[:len(q.history)-1]
+
+	current := make(map[*QueueItem]bool)
+	for _, item := range q.items {
+		current[item] = true
+	}
+	restored := make([]*QueueItem, 0)
+	if len(q.items) > 0 {
+		restored = append(restored, q.items[0])
+	}
+	remembered := make(map[*QueueItem]bool)
+	for _, entry := range last.items {
+		remembered[entry.item] = true
+		// A playing item that was skipped, such as the one interrupted by Be Quiet, is still first until the player
+		// stops, and is added back like any other removed item.
+		if len(restored) > 0 && entry.item == restored[0] && !entry.item.removed {
+			continue
+		}
+		if current[entry.item] && !entry.item.removed {
+			entry.item.balanced = entry.balanced
+			restored = append(restored, entry.item)
+			continue
+		}
+		if !entry.item.removed {
+			// The item finished playing, so there's nothing to restore.
+			continue
+		}
+		// Whatever changed since, such as quiet hours starting or the Media being blocked, applies to restored items
+		// like it does to new ones.
+		if err := CheckAllowed(entry.item.Media, entry.item.start, entry.item.end); err != nil {
+			logrus.Infof("not restoring %v to queue: %v", entry.item.Media.Title, err)
+			continue
+		}
+		item := q.newQueueItem(entry.item.Media, entry.item.owner)
+		item.balanced = entry.balanced
+		item.end = entry.item.end
+		item.start = entry.item.start
+		if err := q.prepare(item); err != nil {
+			logrus.Errorf("could not restore %v to queue: %v", item.Media.Title, err)
+			continue
+		}
+		// Older snapshots still refer to the removed item, which shouldn't be added back a second time.
+		entry.item.removed = false
+		restored = append(restored, item)
+	}
+	q.ordering = last.ordering
+	if last.announcement != nil {
+		// A playing announcement is removed by Advance once the player stops, so the interrupted item plays next.
+		last.announcement.cancel()
+	}
+	// Anything added after the operation is placed like it was just added.
+	for _, item := range q.items {
+		if remembered[item] || item == last.announcement || len(restored) > 0 && item == restored[0] {
+			continue
+		}
+		if item.balanced {
+			restored = q.strategy().Insert(item, restored)
+		} else {
+			restored = append(restored, item)
+		}
+	}
+	wasEmpty := len(q.items) == 0
+	q.items = restored
+	if player := GetPlayer(); wasEmpty && len(q.items) > 0 && player.State == STOPPED {
+		go player.Play(q.items[0])
+	}
+	logrus.Infof("undid queue %v", last.operation)
+	q.sendQueueUpdate()
+	return last.operation, nil
+}
@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// macros are the shorthands that can be used in place of the five cron fields.
+var macros = map[string]string{
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// cronField describes the range of values allowed in one of the five cron fields.
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	// Sunday can be given as either 0 or 7.
+	{name: "day of week", min: 0, max: 7},
+}
+
+// Cron is a parsed cron expression of the form "minute hour day-of-month month day-of-week", where each field is
+// either *, a number, a range like 1-5, a step like */15 or 1-5/2, or a comma separated list of those.
+type Cron struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+	// anyDay and anyWeekday are whether the day of month and day of week were left as *, which matters because a time
+	// matches either restricted field rather than both when both are given, like in standard cron.
+	anyDay     bool
+	anyWeekday bool
+}
+
+// ParseCron parses a cron expression, returning an error if it's invalid.
+func ParseCron(expression string) (Cron, error) {
+	expression = strings.TrimSpace(expression)
+	if macro, ok := macros[expression]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return Cron{}, errors.Errorf("cron expression %q must have %v fields", expression, len(cronFields))
+	}
+	sets := make([]map[int]bool, len(cronFields))
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return Cron{}, err
+		}
+		sets[i] = set
+	}
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return Cron{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a single field of a cron expression into the set of values that it matches.
+func parseCronField(field string, bounds cronField) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return nil, errors.Errorf("invalid step in %v field %q", bounds.name, part)
+			}
+			part = part[:i]
+		}
+		low, high := bounds.min, bounds.max
+		if part != "*" {
+			values := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(values[0]); err != nil {
+				return nil, errors.Errorf("invalid value in %v field %q", bounds.name, part)
+			}
+			high = low
+			if len(values) == 2 {
+				if high, err = strconv.Atoi(values[1]); err != nil {
+					return nil, errors.Errorf("invalid value in %v field %q", bounds.name, part)
+				}
+			} else if step > 1 {
+				// A step from a single value, like 5/15, runs until the end of the range.
+				high = bounds.max
+			}
+		}
+		if low < bounds.min || high > bounds.max || low > high {
+			return nil, errors.Errorf("%v field %q is outside of %v-%v", bounds.name, part, bounds.min, bounds.max)
+		}
+		for value := low; value <= high; value += step {
+			set[value] = true
+		}
+	}
+	return set, nil
+}
+
+// Matches returns whether or not the Cron is due at the minute of the given time.
+func (c Cron) Matches(t time.Time) bool {
+	if !c.minutes[t.Minute()] || !c.hours[t.Hour()] || !c.months[int(t.Month())] {
+		return false
+	}
+	day := c.days[t.Day()]
+	weekday := c.weekdays[int(t.Weekday())]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
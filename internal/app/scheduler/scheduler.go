@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/player"
+)
+
+// Start checks for due Schedules at the beginning of every minute for as long as the application runs. Cron
+// expressions are matched against the local time.
+func Start() {
+	go func() {
+		for {
+			now := time.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			time.Sleep(next.Sub(now))
+			runDue(next)
+		}
+	}()
+}
+
+// Validate returns an error if the Schedule is invalid, including if its cron expression can't be parsed.
+func Validate(schedule db.Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	if _, err := ParseCron(schedule.Cron); err != nil {
+		return errors.Wrap(err, "invalid schedule cron expression")
+	}
+	return nil
+}
+
+// runDue runs every enabled Schedule that is due at the given minute.
+func runDue(t time.Time) {
+	schedules, err := db.GetSchedules(true)
+	if err != nil {
+		logrus.Errorf("could not look up schedules: %v", err)
+		return
+	}
+	for _, schedule := range schedules {
+		cron, err := ParseCron(schedule.Cron)
+		if err != nil {
+			logrus.Warnf("ignoring schedule %v with invalid cron expression: %v", schedule.ID, err)
+			continue
+		}
+		if !cron.Matches(t) {
+			continue
+		}
+		logrus.Infof("running schedule %v (%v): %v", schedule.ID, schedule.Name, schedule.Action)
+		if err := Run(schedule); err != nil {
+			logrus.Errorf("could not run schedule %v: %v", schedule.ID, err)
+		}
+	}
+}
+
+// Run takes the action of the given Schedule right away.
+func Run(schedule db.Schedule) error {
+	queue := player.GetQueue()
+	switch schedule.Action {
+	case db.SCHEDULE_BE_QUIET:
+		announcement := *db.BeQuiet
+		if schedule.MediaID != "" {
+			var err error
+			if announcement, err = db.GetMedia(schedule.MediaID, "internal"); err != nil {
+				return errors.Wrapf(err, "could not find announcement with id %v", schedule.MediaID)
+			}
+		}
+		queue.BeQuiet(announcement)
+	case db.SCHEDULE_CLEAR:
+		queue.Clear()
+	case db.SCHEDULE_ENQUEUE:
+		media, err := db.GetMedia(schedule.MediaID, schedule.MediaType)
+		if err != nil {
+			return errors.Wrapf(err, "could not find media with id %v and type %v", schedule.MediaID,
+				schedule.MediaType)
+		}
+		if err := player.CheckAllowed(media, media.StartTime, media.EndTime); err != nil {
+			return err
+		}
+		queue.AddNext(media, 0)
+	case db.SCHEDULE_PAUSE:
+		return player.GetPlayer().Pause(true)
+	case db.SCHEDULE_RESUME:
+		return player.GetPlayer().Pause(false)
+	case db.SCHEDULE_STOP:
+		return player.GetPlayer().Stop()
+	case db.SCHEDULE_VOLUME:
+		player.GetPlayer().SetVolume(schedule.Volume)
+	default:
+		return errors.Errorf("unknown schedule action %v", schedule.Action)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+)
+
+// IsAdmin returns whether or not the given request carries the configured admin token, either as a bearer token in
+// the Authorization header or in the X-Admin-Token header. No request is an admin if no token is configured.
+func IsAdmin(r *http.Request) bool {
+	token := viper.GetString(constants.ADMIN_TOKEN)
+	if token == "" {
+		return false
+	}
+	given := r.Header.Get("X-Admin-Token")
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		given = strings.TrimPrefix(header, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// Admin wraps a handler so that it only handles requests from admins, responding with 403 Forbidden otherwise.
+func Admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !IsAdmin(r) {
+			message := "this action requires a valid admin token"
+			logrus.Infof("%v: %v %v from %v", message, r.Method, r.URL.Path, r.RemoteAddr)
+			http.Error(w, message, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -7,10 +7,15 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/server/auth"
+	"github.com/Safety-Third/prismriver/internal/app/server/routes/announcements"
+	"github.com/Safety-Third/prismriver/internal/app/server/routes/blocklist"
 	"github.com/Safety-Third/prismriver/internal/app/server/routes/media"
 	"github.com/Safety-Third/prismriver/internal/app/server/routes/player"
 	"github.com/Safety-Third/prismriver/internal/app/server/routes/queue"
 	"github.com/Safety-Third/prismriver/internal/app/server/routes/queue/item"
+	"github.com/Safety-Third/prismriver/internal/app/server/routes/schedules"
+	"github.com/Safety-Third/prismriver/internal/app/server/routes/segments"
 	"github.com/Safety-Third/prismriver/internal/app/server/ws/routes"
 	"net/http"
 	"os"
@@ -23,20 +28,45 @@ func CreateRouter() {
 	wait := time.Duration(15)
 
 	r := mux.NewRouter()
+	r.HandleFunc("/announcements", announcements.IndexHandler).Methods("GET")
+	r.HandleFunc("/announcements", auth.Admin(announcements.StoreHandler)).Methods("POST")
+	r.HandleFunc("/announcements/{id}", auth.Admin(announcements.DeleteHandler)).Methods("DELETE")
+	r.HandleFunc("/blocklist", auth.Admin(blocklist.IndexHandler)).Methods("GET")
+	r.HandleFunc("/blocklist", auth.Admin(blocklist.StoreHandler)).Methods("POST")
+	r.HandleFunc("/blocklist/{id}", auth.Admin(blocklist.DeleteHandler)).Methods("DELETE")
+	r.HandleFunc("/blocklist/{id}", auth.Admin(blocklist.UpdateHandler)).Methods("PUT")
 	r.HandleFunc("/media", media.IndexHandler).Methods("GET")
+	r.HandleFunc("/media/rebuild-index", auth.Admin(media.RebuildIndexHandler)).Methods("POST")
+	r.HandleFunc("/media/refresh", media.RefreshStatusHandler).Methods("GET")
+	r.HandleFunc("/media/refresh", auth.Admin(media.RefreshHandler)).Methods("POST")
+	r.HandleFunc("/media/upload", media.UploadHandler).Methods("POST")
+	r.HandleFunc("/media/{type}/{id}", auth.Admin(media.DeleteHandler)).Methods("DELETE")
+	r.HandleFunc("/media/{type}/{id}", media.ShowHandler).Methods("GET")
 	r.HandleFunc("/media/{type}/{id}", media.UpdateHandler).Methods("PUT")
+	r.HandleFunc("/media/{type}/{id}/prefetch", auth.Admin(media.PrefetchHandler)).Methods("POST")
+	r.HandleFunc("/media/{type}/{id}/segments", segments.IndexHandler).Methods("GET")
+	r.HandleFunc("/media/{type}/{id}/segments", auth.Admin(segments.StoreHandler)).Methods("POST")
+	r.HandleFunc("/media/{type}/{id}/thumbnail", media.ThumbnailHandler).Methods("GET")
 	r.HandleFunc("/player", player.UpdateHandler).Methods("PUT")
 	r.HandleFunc("/queue", queue.IndexHandler).Methods("GET")
 	r.HandleFunc("/queue", queue.StoreHandler).Methods("POST")
 	r.HandleFunc("/queue", queue.UpdateHandler).Methods("PUT")
+	r.HandleFunc("/queue/undo", queue.UndoHandler).Methods("POST")
 	r.HandleFunc("/queue/{id}", item.DeleteHandler).Methods("DELETE")
 	r.HandleFunc("/queue/{id}", item.UpdateHandler).Methods("PUT")
+	r.HandleFunc("/schedules", auth.Admin(schedules.IndexHandler)).Methods("GET")
+	r.HandleFunc("/schedules", auth.Admin(schedules.StoreHandler)).Methods("POST")
+	r.HandleFunc("/schedules/{id}", auth.Admin(schedules.DeleteHandler)).Methods("DELETE")
+	r.HandleFunc("/schedules/{id}", auth.Admin(schedules.UpdateHandler)).Methods("PUT")
+	r.HandleFunc("/segments/{id}", auth.Admin(segments.DeleteHandler)).Methods("DELETE")
+	r.HandleFunc("/segments/{id}", auth.Admin(segments.UpdateHandler)).Methods("PUT")
 	r.HandleFunc("/ws/player", routes.WebsocketPlayerHandler)
 	r.HandleFunc("/ws/queue", routes.WebsocketQueueHandler)
 
 	srv := &http.Server{
 		Addr: ":8000",
 		Handler: handlers.CORS(handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE"}),
+			handlers.AllowedHeaders([]string{"Authorization", "X-Admin-Token"}),
 			handlers.AllowedOrigins([]string{viper.GetString(constants.ORIGIN)}))(r),
 	}
 
@@ -0,0 +1,53 @@
+package announcements
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/downloader"
+	"github.com/Safety-Third/prismriver/internal/app/player"
+)
+
+// DeleteHandler handles requests for removing announcements along with their files. The built-in announcement
+// cannot be removed.
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == db.BeQuiet.ID {
+		message := "the built-in announcement cannot be deleted"
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusForbidden)
+		return
+	}
+	announcement, err := db.GetMedia(id, "internal")
+	if err != nil {
+		message := fmt.Sprintf("could not find announcement %v", id)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+	if player.GetQueue().Has(announcement) {
+		message := fmt.Sprintf("announcement %v is in the queue", id)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+	if err := os.Remove(downloader.FilePath(announcement)); err != nil && !os.IsNotExist(err) {
+		message := fmt.Sprintf("could not remove file of announcement %v: %v", id, err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	if err := db.DeleteMedia(announcement); err != nil {
+		message := fmt.Sprintf("could not delete announcement %v: %v", id, err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("deleted announcement %v", announcement.Title)
+	w.WriteHeader(http.StatusNoContent)
+}
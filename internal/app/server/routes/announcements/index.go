@@ -0,0 +1,41 @@
+package announcements
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// IndexHandler handles requests to list every announcement that can be played for "Be Quiet!".
+func IndexHandler(w http.ResponseWriter, r *http.Request) {
+	announcements, err := db.GetMediaByType("internal")
+	if err != nil {
+		message := fmt.Sprintf("could not look up announcements: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	if announcements == nil {
+		// Cannot return a null list or the frontend will have issues.
+		announcements = make([]db.Media, 0)
+	}
+	writeJSON(w, announcements, http.StatusOK)
+}
+
+// writeJSON writes value as the JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, value interface{}, code int) {
+	response, err := json.Marshal(value)
+	if err != nil {
+		message := fmt.Sprintf("could not generate announcement response: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
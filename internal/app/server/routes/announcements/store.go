@@ -0,0 +1,84 @@
+package announcements
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/downloader"
+)
+
+// StoreHandler handles requests for adding new announcements, either from an uploaded audio file or by speaking the
+// given text with the TTS command.
+func StoreHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, viper.GetInt64(constants.UPLOAD_MAX_SIZE))
+	if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		message := fmt.Sprintf("could not parse form data: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	var announcement db.Media
+	file, header, err := r.FormFile("file")
+	if err == nil {
+		defer func() {
+			if err := file.Close(); err != nil {
+				logrus.Errorf("error closing uploaded file: %v", err)
+			}
+		}()
+		title := r.Form.Get("title")
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+		}
+		if announcement, err = storeUpload(file, title); err != nil {
+			message := fmt.Sprintf("could not add announcement: %v", err)
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusUnsupportedMediaType)
+			return
+		}
+	} else if text := strings.TrimSpace(r.Form.Get("text")); text != "" {
+		if announcement, err = downloader.Speak(text, r.Form.Get("voice")); err != nil {
+			message := fmt.Sprintf("could not add announcement: %v", err)
+			logrus.Errorf(message)
+			http.Error(w, message, http.StatusInternalServerError)
+			return
+		}
+	} else {
+		message := "an announcement needs either a file or text"
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, announcement, http.StatusCreated)
+}
+
+// storeUpload copies an uploaded file somewhere that ffmpeg can read it from and adds it as an announcement.
+func storeUpload(file io.Reader, title string) (db.Media, error) {
+	tempFile, err := ioutil.TempFile("", "prismriver-announcement-")
+	if err != nil {
+		return db.Media{}, err
+	}
+	defer func() {
+		if err := os.Remove(tempFile.Name()); err != nil {
+			logrus.Warnf("error removing uploaded file %v: %v", tempFile.Name(), err)
+		}
+	}()
+	_, err = io.Copy(tempFile, file)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return db.Media{}, err
+	}
+	return downloader.AddAnnouncement(tempFile.Name(), title)
+}
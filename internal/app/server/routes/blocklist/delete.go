@@ -0,0 +1,26 @@
+package blocklist
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// DeleteHandler handles requests for removing Blocks.
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	block, ok := findBlock(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeleteBlock(block); err != nil {
+		message := fmt.Sprintf("could not delete block %v: %v", block.ID, err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("unblocked %v %v", block.Kind, block.Pattern)
+	w.WriteHeader(http.StatusNoContent)
+}
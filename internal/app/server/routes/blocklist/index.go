@@ -0,0 +1,41 @@
+package blocklist
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// IndexHandler handles requests to list every Block.
+func IndexHandler(w http.ResponseWriter, r *http.Request) {
+	blocks, err := db.GetBlocks()
+	if err != nil {
+		message := fmt.Sprintf("could not look up blocklist: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	if blocks == nil {
+		// Cannot return a null list or the frontend will have issues.
+		blocks = make([]db.Block, 0)
+	}
+	writeJSON(w, blocks, http.StatusOK)
+}
+
+// writeJSON writes value as the JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, value interface{}, code int) {
+	response, err := json.Marshal(value)
+	if err != nil {
+		message := fmt.Sprintf("could not generate blocklist response: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
@@ -0,0 +1,41 @@
+package blocklist
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/player"
+)
+
+// StoreHandler handles requests for adding new Blocks. Matching items are removed from the Queue right away.
+func StoreHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		message := fmt.Sprintf("could not parse form data: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	block := db.Block{
+		Kind:    r.Form.Get("kind"),
+		Pattern: r.Form.Get("pattern"),
+		Reason:  r.Form.Get("reason"),
+	}
+	if err := block.Validate(); err != nil {
+		message := fmt.Sprintf("invalid block: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if err := db.AddBlock(&block); err != nil {
+		message := fmt.Sprintf("could not add block: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("blocked %v %v", block.Kind, block.Pattern)
+	player.GetQueue().RemoveMatching(block.Matches)
+	writeJSON(w, block, http.StatusCreated)
+}
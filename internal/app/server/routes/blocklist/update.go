@@ -0,0 +1,71 @@
+package blocklist
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/player"
+)
+
+// UpdateHandler handles requests for changing existing Blocks. Items matching the changed Block are removed from the
+// Queue right away.
+func UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	block, ok := findBlock(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		message := fmt.Sprintf("could not parse form data: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if values, ok := r.Form["kind"]; ok {
+		block.Kind = values[0]
+	}
+	if values, ok := r.Form["pattern"]; ok {
+		block.Pattern = values[0]
+	}
+	if values, ok := r.Form["reason"]; ok {
+		block.Reason = values[0]
+	}
+	if err := block.Validate(); err != nil {
+		message := fmt.Sprintf("invalid block: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if err := db.UpdateBlock(block); err != nil {
+		message := fmt.Sprintf("could not update block %v: %v", block.ID, err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	player.GetQueue().RemoveMatching(block.Matches)
+	writeJSON(w, block, http.StatusOK)
+}
+
+// findBlock returns the Block identified by the request's id variable, responding with an error if there is none.
+func findBlock(w http.ResponseWriter, r *http.Request) (db.Block, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		message := fmt.Sprintf("could not parse %v as block id", vars["id"])
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return db.Block{}, false
+	}
+	block, err := db.GetBlock(uint(id))
+	if err != nil {
+		message := fmt.Sprintf("could not find block %v", id)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return db.Block{}, false
+	}
+	return block, true
+}
@@ -0,0 +1,59 @@
+package media
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/player"
+	"github.com/Safety-Third/prismriver/internal/app/storage"
+)
+
+// DeleteHandler handles requests for deleting Media items along with their stored files.
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	media, err := db.GetMedia(vars["id"], vars["type"])
+	if err != nil {
+		message := fmt.Sprintf("could not find media with id %v and type %v", vars["id"], vars["type"])
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+	switch media.Type {
+	case "internal":
+		message := "internal media cannot be deleted"
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusForbidden)
+		return
+	case "library":
+		// The next scan would just add it again.
+		message := "library media cannot be deleted, remove the file from the library directory instead"
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusForbidden)
+		return
+	}
+	if player.GetQueue().Has(media) {
+		message := fmt.Sprintf("media with id %v and type %v is in the queue", media.ID, media.Type)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+	if err := storage.Remove(media); err != nil {
+		message := fmt.Sprintf("could not remove files of media with id %v and type %v: %v", media.ID, media.Type,
+			err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	if err := db.DeleteMedia(media); err != nil {
+		message := fmt.Sprintf("could not delete media with id %v and type %v: %v", media.ID, media.Type, err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("deleted media with id %v and type %v", media.ID, media.Type)
+	w.WriteHeader(http.StatusNoContent)
+}
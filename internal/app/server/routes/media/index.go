@@ -2,50 +2,121 @@ package media
 
 import (
 	"encoding/json"
-	"github.com/sirupsen/logrus"
-	"github.com/Safety-Third/prismriver/internal/app/db"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
 )
 
+// maxLimit is the maximum number of Media returned in a single response.
+const maxLimit = 255
+
 type indexResponse struct {
-	Media []db.Media `json:"media"`
-	Pages uint `json:"pages"`
+	Cursor string     `json:"cursor,omitempty"`
+	Media  []db.Media `json:"media"`
+	Pages  uint       `json:"pages"`
+	Total  int64      `json:"total"`
 }
 
 // IndexHandler handles requests to list Media in the database.
 func IndexHandler(w http.ResponseWriter, r *http.Request) {
 	params := r.URL.Query()
 	strParam := params.Get("limit")
-	limit, err := strconv.ParseUint(strParam, 10, 8)
-	if err != nil {
+	limit, err := strconv.ParseUint(strParam, 10, 32)
+	if err != nil || limit == 0 {
 		logrus.Infof("could not parse %v as limit, defaulting to 12", strParam)
 		limit = 12
+	} else if limit > maxLimit {
+		limit = maxLimit
+	}
+	options := db.SearchOptions{
+		Cursor: params.Get("cursor"),
+		Limit:  int(limit),
+		Query:  params.Get("query"),
+		Sort:   params.Get("sort"),
+		Type:   params.Get("type"),
+	}
+	if str := params.Get("video"); str != "" {
+		video, err := strconv.ParseBool(str)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not parse %v as video", str), http.StatusBadRequest)
+			return
+		}
+		options.Video = &video
+	}
+	// Lengths are given in seconds, as that's a lot friendlier than the units used by Media.Length.
+	if str := params.Get("min_length"); str != "" {
+		seconds, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not parse %v as min_length", str), http.StatusBadRequest)
+			return
+		}
+		options.MinLength = uint64(seconds * float64(time.Millisecond))
 	}
-	query := params.Get("query")
+	if str := params.Get("max_length"); str != "" {
+		seconds, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not parse %v as max_length", str), http.StatusBadRequest)
+			return
+		}
+		options.MaxLength = uint64(seconds * float64(time.Millisecond))
+	}
+	if str := params.Get("added_since"); str != "" {
+		addedSince, err := time.Parse(time.RFC3339, str)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not parse %v as an RFC 3339 timestamp", str), http.StatusBadRequest)
+			return
+		}
+		options.AddedSince = addedSince
+	}
+	pageParam := params.Get("page")
+	page, err := strconv.ParseUint(pageParam, 10, 32)
+	if err != nil {
+		if pageParam != "" {
+			logrus.Infof("could not parse %v as page, defaulting to 1", pageParam)
+		}
+		page = 1
+	}
+	options.Page = int(page)
+
 	var response indexResponse
-	if query == "" {
+	// Without any criteria, a random selection of Media is returned to browse through.
+	if options.Query == "" && options.Type == "" && options.Video == nil && options.MinLength == 0 &&
+		options.MaxLength == 0 && options.AddedSince.IsZero() && options.Sort == "" && options.Cursor == "" {
+		media := db.GetRandomMedia(int(limit))
 		response = indexResponse{
-			Media: db.GetRandomMedia(int(limit)),
+			Media: media,
 			Pages: 1,
+			Total: int64(len(media)),
 		}
 	} else {
-		pageParam := params.Get("page")
-		page, err := strconv.ParseUint(pageParam, 10, 8)
+		result, err := db.FindMedia(options)
 		if err != nil {
-			logrus.Infof("could not parse %v as page, defaulting to 1", pageParam)
-			page = 1
+			message := fmt.Sprintf("could not search media: %v", err)
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusBadRequest)
+			return
 		}
-		media, pages := db.FindMedia(query, int(limit), int(page))
 		response = indexResponse{
-			Media: media,
-			Pages: pages,
+			Cursor: result.NextCursor,
+			Media:  result.Media,
+			Pages:  result.Pages,
+			Total:  result.Total,
 		}
 	}
+	if response.Media == nil {
+		// Cannot return a null list or the frontend will have issues.
+		response.Media = make([]db.Media, 0)
+	}
 	data, err := json.Marshal(response)
 	if err != nil {
 		logrus.Errorf("could not generate media index response: %v", err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(data)
 }
@@ -0,0 +1,41 @@
+package media
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/player"
+)
+
+// PrefetchHandler handles requests for selecting Media items to be downloaded in the background ahead of time.
+func PrefetchHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	media, err := db.GetMedia(vars["id"], vars["type"])
+	if err != nil {
+		message := fmt.Sprintf("could not find media with id %v and type %v", vars["id"], vars["type"])
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+	if media.Stream {
+		message := fmt.Sprintf("media with id %v and type %v is a stream and cannot be prefetched", media.ID,
+			media.Type)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		logrus.Warnf("error parsing form data from POST /media/%v/%v/prefetch: %v", vars["type"], vars["id"], err)
+	}
+	str := r.Form.Get("video")
+	if video, err := strconv.ParseBool(str); err == nil {
+		media.Video = media.Video && video
+	}
+	player.GetPrefetcher().Add(media)
+	w.WriteHeader(http.StatusAccepted)
+}
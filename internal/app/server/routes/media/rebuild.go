@@ -0,0 +1,32 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// RebuildIndexHandler handles requests for rebuilding the Media search index from scratch.
+func RebuildIndexHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := db.RebuildIndex()
+	if err != nil {
+		message := fmt.Sprintf("could not rebuild search index: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("rebuilt search index: %v of %v media indexed", stats.Indexed, stats.Media)
+	response, err := json.Marshal(stats)
+	if err != nil {
+		message := fmt.Sprintf("could not generate rebuild response: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
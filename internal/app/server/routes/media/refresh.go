@@ -0,0 +1,43 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/downloader"
+)
+
+// RefreshHandler handles requests for starting a metadata refresh of every downloaded Media item.
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	refresher := downloader.GetRefresher()
+	if err := refresher.Start(); err != nil {
+		message := fmt.Sprintf("could not start metadata refresh: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+	writeRefreshStatus(w, refresher.Status(), http.StatusAccepted)
+}
+
+// RefreshStatusHandler handles requests for the progress of the current or most recent metadata refresh, including
+// any Media whose source could no longer be retrieved.
+func RefreshStatusHandler(w http.ResponseWriter, r *http.Request) {
+	writeRefreshStatus(w, downloader.GetRefresher().Status(), http.StatusOK)
+}
+
+// writeRefreshStatus writes the given RefreshStatus as the JSON response with the given status code.
+func writeRefreshStatus(w http.ResponseWriter, status downloader.RefreshStatus, code int) {
+	response, err := json.Marshal(status)
+	if err != nil {
+		message := fmt.Sprintf("could not generate refresh response: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
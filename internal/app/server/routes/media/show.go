@@ -0,0 +1,53 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+type showResponse struct {
+	db.Media
+	Files []db.MediaFile
+}
+
+// ShowHandler handles requests for a single Media item along with the files stored for it.
+func ShowHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	media, err := db.GetMedia(vars["id"], vars["type"])
+	if err != nil {
+		message := fmt.Sprintf("could not find media with id %v and type %v", vars["id"], vars["type"])
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+	files, err := db.GetMediaFiles(media)
+	if err != nil {
+		message := fmt.Sprintf("could not look up files for media with id %v and type %v: %v", media.ID, media.Type,
+			err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	if files == nil {
+		// Cannot return a null list or the frontend will have issues.
+		files = make([]db.MediaFile, 0)
+	}
+	response, err := json.Marshal(showResponse{
+		Media: media,
+		Files: files,
+	})
+	if err != nil {
+		message := fmt.Sprintf("could not generate media response: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
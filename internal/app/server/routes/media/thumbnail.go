@@ -0,0 +1,35 @@
+package media
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/storage"
+)
+
+// ThumbnailHandler handles requests for the locally cached thumbnail of Media items.
+func ThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	media, err := db.GetMedia(vars["id"], vars["type"])
+	if err != nil {
+		message := fmt.Sprintf("could not find media with id %v and type %v", vars["id"], vars["type"])
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+	thumbnailPath, err := storage.Thumbnail(media)
+	if err != nil {
+		message := fmt.Sprintf("no thumbnail available for media with id %v and type %v", media.ID, media.Type)
+		logrus.Infof("%v: %v", message, err)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Content-Type", "image/jpeg")
+	// ServeFile takes care of Last-Modified and conditional requests.
+	http.ServeFile(w, r, thumbnailPath)
+}
@@ -7,11 +7,15 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/Safety-Third/prismriver/internal/app/db"
 	"github.com/Safety-Third/prismriver/internal/app/downloader"
+	"github.com/Safety-Third/prismriver/internal/app/server/auth"
+	"github.com/Safety-Third/prismriver/internal/app/server/routes/queue"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
-// UpdateHandler handles requests for updating Media items.
+// UpdateHandler handles requests for updating Media items. Overriding fields, resetting overrides and refreshing
+// metadata are restricted to admins.
 func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	media, err := db.GetMedia(vars["id"], vars["type"])
@@ -37,8 +41,40 @@ func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		logrus.Infof("could not parse %v as bool, ignoring", str)
 	}
+	str = r.Form.Get("metadata")
+	metadata, err := strconv.ParseBool(str)
+	if err != nil {
+		logrus.Infof("could not parse %v as bool, ignoring", str)
+	}
+	overriding := len(r.Form["reset"]) > 0
+	for key := range r.Form {
+		if strings.HasPrefix(key, "override_") {
+			overriding = true
+		}
+	}
+	if (overriding || metadata) && !auth.IsAdmin(r) {
+		message := "only admins can override, reset or refresh the metadata of media"
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusForbidden)
+		return
+	}
+	refresh := videoErr == nil && video != media.Video && video || length || title || metadata
+	if refresh && media.IsLocal() {
+		message := fmt.Sprintf("media with id %v and type %v is stored locally and cannot be refreshed", media.ID,
+			media.Type)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
 	modified := false
-	if videoErr == nil && video != media.Video && video || length || title {
+	// Clearing overrides first allows them to be refreshed in the same request.
+	for _, field := range r.Form["reset"] {
+		if media.IsOverridden(field) {
+			media.ClearOverride(field)
+			modified = true
+		}
+	}
+	if refresh {
 		newMedia, err := downloader.GetInfo(media.URL, video)
 		if err != nil {
 			message := fmt.Sprintf("could not get info for media with url %v: %v", media.URL, err)
@@ -54,15 +90,47 @@ func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 			media.Length = newMedia.Length
 			modified = true
 		}
-		if title && newMedia.Title != media.Title {
+		if title && newMedia.Title != media.Title && !media.IsOverridden("title") {
 			media.Title = newMedia.Title
 			modified = true
 		}
+		if metadata {
+			media.UpdateMetadata(newMedia)
+			modified = true
+		}
 	}
 	if videoErr == nil && video != media.Video && !video {
 		media.Video = video
 		modified = true
 	}
+	// Manual values take precedence over anything that was just refreshed.
+	for key, values := range r.Form {
+		if !strings.HasPrefix(key, "override_") {
+			continue
+		}
+		if err := media.Override(strings.TrimPrefix(key, "override_"), values[0]); err != nil {
+			message := fmt.Sprintf("could not override field of media with id %v and type %v: %v", media.ID,
+				media.Type, err)
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+		modified = true
+	}
+	if r.Form.Get("start") != "" || r.Form.Get("end") != "" {
+		start, end, err := queue.Trim(r, media, media.StartTime, media.EndTime)
+		if err != nil {
+			message := fmt.Sprintf("could not trim media with id %v and type %v: %v", media.ID, media.Type, err)
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+		if start != media.StartTime || end != media.EndTime {
+			media.StartTime = start
+			media.EndTime = end
+			modified = true
+		}
+	}
 	if !modified {
 		logrus.Infof("media with id %v and type %v has no fields to update, ignoring", vars["id"], vars["type"])
 		w.WriteHeader(http.StatusNotModified)
@@ -0,0 +1,179 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/downloader"
+	"github.com/Safety-Third/prismriver/internal/app/player"
+	"github.com/Safety-Third/prismriver/internal/app/server/routes/queue"
+)
+
+// UploadHandler handles requests for adding local media files as new Media items.
+func UploadHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, viper.GetInt64(constants.UPLOAD_MAX_SIZE))
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		message := fmt.Sprintf("could not parse uploaded file: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		message := fmt.Sprintf("no file provided in upload: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logrus.Errorf("error closing uploaded file: %v", err)
+		}
+	}()
+	sourceDir := path.Join(viper.GetString(constants.DATA), "upload", "source")
+	if err := os.MkdirAll(sourceDir, os.ModeDir|0755); err != nil {
+		message := fmt.Sprintf("could not create upload directory: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	tempFile, err := ioutil.TempFile(sourceDir, "upload-")
+	if err != nil {
+		message := fmt.Sprintf("could not create file for upload: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tempFile, hash), file)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeUpload(tempFile.Name())
+		message := fmt.Sprintf("could not store uploaded file: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	// Identical uploads share the same ID, so the same file is only ever stored once.
+	id := hex.EncodeToString(hash.Sum(nil))[:16]
+
+	status := http.StatusOK
+	media, err := db.GetMedia(id, "upload")
+	if err == nil {
+		removeUpload(tempFile.Name())
+	} else {
+		ext := strings.ToLower(filepath.Ext(header.Filename))
+		sourcePath := path.Join(sourceDir, id+ext)
+		if err := os.Rename(tempFile.Name(), sourcePath); err != nil {
+			removeUpload(tempFile.Name())
+			message := fmt.Sprintf("could not store uploaded file: %v", err)
+			logrus.Errorf(message)
+			http.Error(w, message, http.StatusInternalServerError)
+			return
+		}
+		result, err := downloader.Probe(sourcePath)
+		if err != nil {
+			removeUpload(sourcePath)
+			message := fmt.Sprintf("uploaded file is not a supported media file: %v", err)
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusUnsupportedMediaType)
+			return
+		}
+		// The type is taken from the file itself, as the one given by the client can't be trusted.
+		if mimeType := result.MimeType(); !allowedType(mimeType) {
+			removeUpload(sourcePath)
+			message := fmt.Sprintf("uploaded file has unsupported type %v", result.Format.FormatName)
+			if mimeType != "" {
+				message = fmt.Sprintf("uploaded file has unsupported type %v", mimeType)
+			}
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusUnsupportedMediaType)
+			return
+		}
+		video, err := strconv.ParseBool(r.Form.Get("video"))
+		if err != nil {
+			video = false
+		}
+		title := result.Tag("title")
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+		}
+		absolute, err := filepath.Abs(sourcePath)
+		if err != nil {
+			absolute = sourcePath
+		}
+		media = db.Media{
+			ID:     id,
+			Length: result.Length(),
+			Title:  title,
+			Type:   "upload",
+			Video:  video && result.HasVideo(),
+			URL:    (&url.URL{Scheme: "file", Path: absolute}).String(),
+		}
+		if err := db.AddMedia(media); err != nil {
+			removeUpload(sourcePath)
+			message := fmt.Sprintf("could not store uploaded media: %v", err)
+			logrus.Errorf(message)
+			http.Error(w, message, http.StatusInternalServerError)
+			return
+		}
+		logrus.Infof("stored uploaded file %v as media with id %v", header.Filename, id)
+		status = http.StatusCreated
+	}
+
+	if enqueue, err := strconv.ParseBool(r.Form.Get("enqueue")); err == nil && enqueue {
+		if queue.Rejected(w, media, media.StartTime, media.EndTime) {
+			return
+		}
+		player.GetQueue().Add(media, queue.Owner(r))
+	} else {
+		// Transcode the upload ahead of time so that it's ready whenever it does get played.
+		player.GetPrefetcher().Add(media)
+	}
+
+	response, err := json.Marshal(media)
+	if err != nil {
+		message := fmt.Sprintf("could not generate media response: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// allowedType returns whether or not files of the given MIME type are allowed to be uploaded.
+func allowedType(mimeType string) bool {
+	for _, allowed := range viper.GetStringSlice(constants.UPLOAD_TYPES) {
+		if strings.EqualFold(mimeType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeUpload removes a stored upload that could not be used.
+func removeUpload(filePath string) {
+	if err := os.Remove(filePath); err != nil {
+		logrus.Warnf("error removing uploaded file %v: %v", filePath, err)
+	}
+}
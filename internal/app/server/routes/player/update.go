@@ -6,6 +6,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/Safety-Third/prismriver/internal/app/db"
 	"github.com/Safety-Third/prismriver/internal/app/player"
 )
 
@@ -18,9 +19,28 @@ func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 	playerInstance := player.GetPlayer()
 	queue := player.GetQueue()
 
+	pause := r.Form.Get("pause")
+	if len(pause) > 0 {
+		paused, err := strconv.ParseBool(pause)
+		if err != nil {
+			logrus.Warnf("error parsing pause: %v", err)
+		} else if err := playerInstance.Pause(paused); err != nil {
+			logrus.Infof("could not pause player: %v", err)
+		}
+	}
+
 	quiet := r.Form.Get("quiet")
 	if len(quiet) > 0 {
-		queue.BeQuiet()
+		announcement := *db.BeQuiet
+		if id := r.Form.Get("announcement"); len(id) > 0 {
+			media, err := db.GetMedia(id, "internal")
+			if err != nil {
+				logrus.Warnf("could not find announcement with id %v, using the default: %v", id, err)
+			} else {
+				announcement = media
+			}
+		}
+		queue.BeQuiet(announcement)
 	}
 
 	seek := r.Form.Get("seek")
@@ -1,14 +1,18 @@
 package item
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/Safety-Third/prismriver/internal/app/player"
+	"github.com/Safety-Third/prismriver/internal/app/server/auth"
+	"github.com/Safety-Third/prismriver/internal/app/server/routes/queue"
 	"net/http"
 	"strconv"
 )
 
-// UpdateHandler handles requests for moving QueueItems around in the Queue.
+// UpdateHandler handles requests for moving QueueItems around in the Queue and changing where they start and end.
 func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	index, err := strconv.ParseUint(vars["id"], 10, 8)
@@ -16,10 +20,28 @@ func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 		logrus.Warn("Error parsing int in UpdateHandler, user likely provided incorrect input.")
 		return
 	}
-	queue := player.GetQueue()
 	r.ParseForm()
+	if r.Form.Get("start") != "" || r.Form.Get("end") != "" {
+		trim(w, r, int(index))
+		return
+	}
+	queue := player.GetQueue()
 	move := r.Form.Get("move")
 	switch move {
+	case "bump":
+		bump(w, r, int(index))
+	case "next":
+		if !auth.IsAdmin(r) {
+			message := "playing an item next requires a valid admin token"
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusForbidden)
+			return
+		}
+		if err := queue.PlayNext(int(index)); err != nil {
+			message := fmt.Sprintf("could not play queue item at index %v next: %v", index, err)
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusBadRequest)
+		}
 	case "bottom":
 		queue.MoveTo(int(index), -1)
 	case "down":
@@ -37,3 +59,54 @@ func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 		queue.MoveTo(int(index), int(to))
 	}
 }
+
+// bump handles requests for spending a bump credit on the QueueItem at index, responding with the number of credits
+// left.
+func bump(w http.ResponseWriter, r *http.Request, index int) {
+	credits, err := player.GetQueue().Bump(index, queue.Owner(r))
+	if err != nil {
+		code := http.StatusBadRequest
+		switch err {
+		case player.ErrNoBumpCredits:
+			code = http.StatusTooManyRequests
+		case player.ErrNotOwner:
+			code = http.StatusForbidden
+		}
+		message := fmt.Sprintf("could not bump queue item at index %v: %v", index, err)
+		logrus.Infof(message)
+		http.Error(w, message, code)
+		return
+	}
+	response, err := json.Marshal(struct {
+		Credits int `json:"credits"`
+	}{credits})
+	if err != nil {
+		message := fmt.Sprintf("could not generate bump response: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// trim handles requests for changing where the QueueItem at index starts and ends.
+func trim(w http.ResponseWriter, r *http.Request, index int) {
+	items := player.GetQueue()
+	item, ok := items.Get(index)
+	if !ok {
+		message := fmt.Sprintf("no queue item at index %v", index)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+	start, end, err := queue.Trim(r, item.Media, item.Start, item.End)
+	if err == nil {
+		err = items.SetTrim(index, start, end)
+	}
+	if err != nil {
+		message := fmt.Sprintf("could not trim queue item at index %v: %v", index, err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+	}
+}
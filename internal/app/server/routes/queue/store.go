@@ -2,10 +2,13 @@ package queue
 
 import (
 	"encoding/binary"
+	"fmt"
 	"net"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/Safety-Third/prismriver/internal/app/db"
@@ -13,6 +16,21 @@ import (
 	"github.com/Safety-Third/prismriver/internal/app/player"
 )
 
+// Owner returns the identifier used for the owner of QueueItems added by the given request, based on its IP address.
+func Owner(r *http.Request) uint32 {
+	var ip uint32 = 0
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if parsed := net.ParseIP(host); parsed != nil {
+			if len(parsed) == 16 {
+				ip = binary.BigEndian.Uint32(parsed[12:16])
+			} else {
+				ip = binary.BigEndian.Uint32(parsed)
+			}
+		}
+	}
+	return ip
+}
+
 // StoreHandler handles requests for adding new QueueItems.
 func StoreHandler(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
@@ -28,52 +46,106 @@ func StoreHandler(w http.ResponseWriter, r *http.Request) {
 		video = false
 	}
 
-	var ip uint32 = 0
-	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
-		if parsed := net.ParseIP(host); parsed != nil {
-			if len(parsed) == 16 {
-				ip = binary.BigEndian.Uint32(parsed[12:16])
-			} else {
-				ip = binary.BigEndian.Uint32(parsed)
-			}
+	ip := Owner(r)
+	queue := player.GetQueue()
+	add := func(media db.Media) {
+		start, end, err := Trim(r, media, media.StartTime, media.EndTime)
+		if err != nil {
+			message := fmt.Sprintf("could not trim %v: %v", media.Title, err)
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusBadRequest)
+			return
 		}
+		if Rejected(w, media, start, end) {
+			return
+		}
+		queue.AddTrimmed(media, ip, start, end)
 	}
 
 	if len(id) > 0 && len(kind) > 0 {
 		media, err := db.GetMedia(id, kind)
 		if err == nil {
-			queue := player.GetQueue()
-			queue.Add(media, ip)
+			add(media)
 			return
 		}
 	}
 	if len(url) != 0 {
-		if downloader.ValidateURL(url) {
-			queue := player.GetQueue()
-			media, err := db.GetMediaByURL(url)
-			if err == nil {
-				queue.Add(media, ip)
-				return
-			}
-			newMedia, err := downloader.GetInfo(url, video)
-			if err != nil {
-				logrus.Errorf("could not get media info for %v, %v", url, err)
-				return
-			}
-			media, err = db.GetMedia(newMedia.ID, newMedia.Type)
-			if err == nil {
-				queue.Add(media, ip)
-				return
-			}
-			if err := db.AddMedia(newMedia); err != nil {
-				logrus.Errorf("error storing new media item; %v", err)
-				return
-			}
-			queue.Add(newMedia, ip)
+		if err := downloader.ValidateURL(url); err != nil {
+			reject(w, url, err)
 			return
 		}
-		logrus.Infof("client attempted to add unsupported media %v, ignoring", url)
+		media, err := db.GetMediaByURL(url)
+		if err == nil {
+			add(media)
+			return
+		}
+		newMedia, err := downloader.GetAllowedInfo(url, video)
+		if err != nil {
+			reject(w, url, err)
+			return
+		}
+		// Media that can't be queued isn't stored either.
+		if Rejected(w, newMedia, newMedia.StartTime, newMedia.EndTime) {
+			return
+		}
+		media, err = db.GetMedia(newMedia.ID, newMedia.Type)
+		if err == nil {
+			add(media)
+			return
+		}
+		if err := db.AddMedia(newMedia); err != nil {
+			logrus.Errorf("error storing new media item; %v", err)
+			return
+		}
+		add(newMedia)
 		return
 	}
 	logrus.Warn("User sent an empty POST request, ignoring.")
 }
+
+// Trim returns the start and end times given in the parsed form of the request for playing the given Media, falling
+// back to start and end for any that are missing. Times are given in seconds, as that's a lot friendlier than the
+// units used by Media.Length.
+func Trim(r *http.Request, media db.Media, start uint64, end uint64) (uint64, uint64, error) {
+	if str := r.Form.Get("start"); str != "" {
+		seconds, err := strconv.ParseFloat(str, 64)
+		if err != nil || seconds < 0 {
+			return 0, 0, errors.Errorf("could not parse %v as start", str)
+		}
+		start = uint64(seconds * float64(time.Millisecond))
+	}
+	if str := r.Form.Get("end"); str != "" {
+		seconds, err := strconv.ParseFloat(str, 64)
+		if err != nil || seconds < 0 {
+			return 0, 0, errors.Errorf("could not parse %v as end", str)
+		}
+		end = uint64(seconds * float64(time.Millisecond))
+	}
+	if err := media.ValidateTrim(start, end); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// Rejected responds with the reason that the given Media cannot be queued to play between start and end and returns
+// true if player.CheckAllowed doesn't allow it.
+func Rejected(w http.ResponseWriter, media db.Media, start uint64, end uint64) bool {
+	if err := player.CheckAllowed(media, start, end); err != nil {
+		reject(w, media.URL, err)
+		return true
+	}
+	return false
+}
+
+// reject responds with the reason that the media at url cannot be queued. RejectionErrors are returned to the client
+// as is, while anything else is treated as a failure to look up the media.
+func reject(w http.ResponseWriter, url string, err error) {
+	if rejection, ok := err.(downloader.RejectionError); ok {
+		logrus.Infof("rejected %v: %v", url, rejection.Reason)
+		http.Error(w, rejection.Reason, http.StatusForbidden)
+		return
+	}
+	message := fmt.Sprintf("could not get media info for %v: %v", url, err)
+	logrus.Errorf(message)
+	http.Error(w, message, http.StatusBadGateway)
+}
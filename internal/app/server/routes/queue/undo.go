@@ -0,0 +1,27 @@
+package queue
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/player"
+)
+
+// UndoHandler handles requests for undoing the last operation that changed the order of the Queue.
+func UndoHandler(w http.ResponseWriter, r *http.Request) {
+	operation, err := player.GetQueue().Undo()
+	if err == player.ErrNothingToUndo {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		message := fmt.Sprintf("could not undo queue operation: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("undid %v from %v", operation, r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
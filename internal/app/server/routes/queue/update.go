@@ -1,20 +1,33 @@
 package queue
 
 import (
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/Safety-Third/prismriver/internal/app/player"
 	"net/http"
 	"strconv"
 )
 
-// UpdateHandler handles requests for updating Queue instance settings.
+// UpdateHandler handles requests for updating Queue instance settings. The ordering is given by name, or by the older
+// balancing boolean, which switches between balanced and fifo ordering.
 func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
-	balancing, err := strconv.ParseBool(r.Form.Get("balancing"))
-	if err != nil {
-		logrus.Warnf("error parsing boolean from balancing input, defaulting to true")
-		balancing = true
+	ordering := r.Form.Get("ordering")
+	if ordering == "" {
+		balancing, err := strconv.ParseBool(r.Form.Get("balancing"))
+		if err != nil {
+			logrus.Warnf("error parsing boolean from balancing input, defaulting to true")
+			balancing = true
+		}
+		ordering = player.ORDERING_FIFO
+		if balancing {
+			ordering = player.ORDERING_BALANCED
+		}
 	}
 	queue := player.GetQueue()
-	queue.SetBalancing(balancing)
+	if err := queue.SetOrdering(ordering); err != nil {
+		message := fmt.Sprintf("could not change queue ordering: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+	}
 }
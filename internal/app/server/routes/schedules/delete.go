@@ -0,0 +1,26 @@
+package schedules
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// DeleteHandler handles requests for removing Schedules.
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := findSchedule(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeleteSchedule(schedule); err != nil {
+		message := fmt.Sprintf("could not delete schedule %v: %v", schedule.ID, err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("deleted schedule %v", schedule.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,41 @@
+package schedules
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// IndexHandler handles requests to list every Schedule.
+func IndexHandler(w http.ResponseWriter, r *http.Request) {
+	schedules, err := db.GetSchedules(false)
+	if err != nil {
+		message := fmt.Sprintf("could not look up schedules: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	if schedules == nil {
+		// Cannot return a null list or the frontend will have issues.
+		schedules = make([]db.Schedule, 0)
+	}
+	writeJSON(w, schedules, http.StatusOK)
+}
+
+// writeJSON writes value as the JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, value interface{}, code int) {
+	response, err := json.Marshal(value)
+	if err != nil {
+		message := fmt.Sprintf("could not generate schedule response: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
@@ -0,0 +1,39 @@
+package schedules
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// StoreHandler handles requests for adding new Schedules. Schedules are enabled unless enabled is set to false.
+func StoreHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		message := fmt.Sprintf("could not parse form data: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	schedule := db.Schedule{
+		Action:    r.Form.Get("action"),
+		Cron:      r.Form.Get("cron"),
+		Enabled:   true,
+		MediaID:   r.Form.Get("media_id"),
+		MediaType: r.Form.Get("media_type"),
+		Name:      r.Form.Get("name"),
+	}
+	if !parseForm(w, r, &schedule) {
+		return
+	}
+	if err := db.AddSchedule(&schedule); err != nil {
+		message := fmt.Sprintf("could not add schedule: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("added schedule %v to %v at %v", schedule.ID, schedule.Action, schedule.Cron)
+	writeJSON(w, schedule, http.StatusCreated)
+}
@@ -0,0 +1,118 @@
+package schedules
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/scheduler"
+)
+
+// UpdateHandler handles requests for changing existing Schedules, including enabling and disabling them.
+func UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := findSchedule(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		message := fmt.Sprintf("could not parse form data: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if values, ok := r.Form["action"]; ok {
+		schedule.Action = values[0]
+	}
+	if values, ok := r.Form["cron"]; ok {
+		schedule.Cron = values[0]
+	}
+	if values, ok := r.Form["media_id"]; ok {
+		schedule.MediaID = values[0]
+	}
+	if values, ok := r.Form["media_type"]; ok {
+		schedule.MediaType = values[0]
+	}
+	if values, ok := r.Form["name"]; ok {
+		schedule.Name = values[0]
+	}
+	if !parseForm(w, r, &schedule) {
+		return
+	}
+	if err := db.UpdateSchedule(schedule); err != nil {
+		message := fmt.Sprintf("could not update schedule %v: %v", schedule.ID, err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, schedule, http.StatusOK)
+}
+
+// parseForm applies the enabled and volume fields of the request to schedule and validates the result, responding
+// with an error if anything is invalid.
+func parseForm(w http.ResponseWriter, r *http.Request, schedule *db.Schedule) bool {
+	if values, ok := r.Form["enabled"]; ok {
+		enabled, err := strconv.ParseBool(values[0])
+		if err != nil {
+			message := fmt.Sprintf("could not parse %v as enabled", values[0])
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusBadRequest)
+			return false
+		}
+		schedule.Enabled = enabled
+	}
+	if values, ok := r.Form["volume"]; ok {
+		volume, err := strconv.Atoi(values[0])
+		if err != nil {
+			message := fmt.Sprintf("could not parse %v as volume", values[0])
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusBadRequest)
+			return false
+		}
+		schedule.Volume = volume
+	}
+	if err := scheduler.Validate(*schedule); err != nil {
+		message := fmt.Sprintf("invalid schedule: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return false
+	}
+	announcement := schedule.Action == db.SCHEDULE_BE_QUIET && schedule.MediaID != ""
+	if announcement {
+		schedule.MediaType = "internal"
+	}
+	if schedule.Action == db.SCHEDULE_ENQUEUE || announcement {
+		if _, err := db.GetMedia(schedule.MediaID, schedule.MediaType); err != nil {
+			message := fmt.Sprintf("could not find media with id %v and type %v", schedule.MediaID,
+				schedule.MediaType)
+			logrus.Infof(message)
+			http.Error(w, message, http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// findSchedule returns the Schedule identified by the request's id variable, responding with an error if there is
+// none.
+func findSchedule(w http.ResponseWriter, r *http.Request) (db.Schedule, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		message := fmt.Sprintf("could not parse %v as schedule id", vars["id"])
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return db.Schedule{}, false
+	}
+	schedule, err := db.GetSchedule(uint(id))
+	if err != nil {
+		message := fmt.Sprintf("could not find schedule %v", id)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return db.Schedule{}, false
+	}
+	return schedule, true
+}
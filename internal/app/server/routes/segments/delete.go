@@ -0,0 +1,25 @@
+package segments
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// DeleteHandler handles requests for removing Segments.
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	segment, ok := findSegment(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeleteSegment(segment); err != nil {
+		message := fmt.Sprintf("could not delete segment %v: %v", segment.ID, err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
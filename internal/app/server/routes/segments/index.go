@@ -0,0 +1,51 @@
+package segments
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// IndexHandler handles requests to list every Segment of a Media item.
+func IndexHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	media, err := db.GetMedia(vars["id"], vars["type"])
+	if err != nil {
+		message := fmt.Sprintf("could not find media with id %v and type %v", vars["id"], vars["type"])
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+	segments, err := db.GetSegments(media)
+	if err != nil {
+		message := fmt.Sprintf("could not look up segments of media with id %v and type %v: %v", media.ID,
+			media.Type, err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	if segments == nil {
+		// Cannot return a null list or the frontend will have issues.
+		segments = make([]db.Segment, 0)
+	}
+	writeJSON(w, segments, http.StatusOK)
+}
+
+// writeJSON writes value as the JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, value interface{}, code int) {
+	response, err := json.Marshal(value)
+	if err != nil {
+		message := fmt.Sprintf("could not generate segment response: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
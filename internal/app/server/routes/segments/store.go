@@ -0,0 +1,74 @@
+package segments
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// StoreHandler handles requests for adding new Segments to a Media item.
+func StoreHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	media, err := db.GetMedia(vars["id"], vars["type"])
+	if err != nil {
+		message := fmt.Sprintf("could not find media with id %v and type %v", vars["id"], vars["type"])
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		message := fmt.Sprintf("could not parse form data: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	segment := db.Segment{
+		Category:  r.Form.Get("category"),
+		MediaID:   media.ID,
+		MediaType: media.Type,
+	}
+	if err := parseTimes(r, &segment); err != nil {
+		message := fmt.Sprintf("invalid segment: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if err := segment.Validate(); err != nil {
+		message := fmt.Sprintf("invalid segment: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if err := db.AddSegment(&segment); err != nil {
+		message := fmt.Sprintf("could not add segment: %v", err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("added %v segment to %v", segment.Category, media.Title)
+	writeJSON(w, segment, http.StatusCreated)
+}
+
+// parseTimes sets the start and end times of the Segment from the parsed form of the request, if they were given.
+// Times are given in seconds, as that's a lot friendlier than the units used by Media.Length.
+func parseTimes(r *http.Request, segment *db.Segment) error {
+	for name, target := range map[string]*uint64{"end": &segment.EndTime, "start": &segment.StartTime} {
+		str := r.Form.Get(name)
+		if str == "" {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(str, 64)
+		if err != nil || seconds < 0 {
+			return errors.Errorf("could not parse %v as %v", str, name)
+		}
+		*target = uint64(seconds * float64(time.Millisecond))
+	}
+	return nil
+}
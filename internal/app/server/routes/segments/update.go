@@ -0,0 +1,68 @@
+package segments
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Safety-Third/prismriver/internal/app/db"
+)
+
+// UpdateHandler handles requests for changing existing Segments.
+func UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	segment, ok := findSegment(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		message := fmt.Sprintf("could not parse form data: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if values, ok := r.Form["category"]; ok {
+		segment.Category = values[0]
+	}
+	if err := parseTimes(r, &segment); err != nil {
+		message := fmt.Sprintf("invalid segment: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if err := segment.Validate(); err != nil {
+		message := fmt.Sprintf("invalid segment: %v", err)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if err := db.UpdateSegment(segment); err != nil {
+		message := fmt.Sprintf("could not update segment %v: %v", segment.ID, err)
+		logrus.Errorf(message)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, segment, http.StatusOK)
+}
+
+// findSegment returns the Segment identified by the request's id variable, responding with an error if there is none.
+func findSegment(w http.ResponseWriter, r *http.Request) (db.Segment, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		message := fmt.Sprintf("could not parse %v as segment id", vars["id"])
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusBadRequest)
+		return db.Segment{}, false
+	}
+	segment, err := db.GetSegment(uint(id))
+	if err != nil {
+		message := fmt.Sprintf("could not find segment %v", id)
+		logrus.Infof(message)
+		http.Error(w, message, http.StatusNotFound)
+		return db.Segment{}, false
+	}
+	return segment, true
+}
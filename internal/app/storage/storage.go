@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/downloader"
+)
+
+// legacyExtensions are the extensions that files were stored with before MediaFiles were recorded in the database.
+var legacyExtensions = []string{".opus", ".mp4", ".video"}
+
+// discovering holds the keys of the Media whose legacy files are being recorded in the background, so that each is
+// only checksummed and probed once.
+var discovering = struct {
+	sync.Mutex
+	keys map[string]bool
+}{keys: make(map[string]bool)}
+
+// Record stores information about the file at filePath as a MediaFile belonging to the given Media.
+func Record(media db.Media, filePath string, profile string) error {
+	relative, err := filepath.Rel(viper.GetString(constants.DATA), filePath)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	checksum, err := checksum(filePath)
+	if err != nil {
+		return err
+	}
+	file := db.MediaFile{
+		Checksum:  checksum,
+		Container: strings.TrimPrefix(path.Ext(filePath), "."),
+		MediaID:   media.ID,
+		MediaType: media.Type,
+		Path:      relative,
+		Profile:   profile,
+		Size:      info.Size(),
+		Video:     media.Video,
+	}
+	if result, err := downloader.Probe(filePath); err != nil {
+		logrus.Warnf("could not probe codecs of %v, ignoring: %v", filePath, err)
+	} else {
+		file.AudioCodec = result.Codec("audio")
+		file.VideoCodec = result.Codec("video")
+	}
+	if err := db.AddMediaFile(file); err != nil {
+		return err
+	}
+	logrus.Debugf("recorded file %v for media with id %v and type %v", relative, media.ID, media.Type)
+	return nil
+}
+
+// Resolve returns the path of a stored file for the given Media. The file produced by the currently selected
+// transcoding profile is preferred, falling back to any other stored variant with the same video status so that
+// changing profiles doesn't require downloading everything again. Resolve only looks at the database and the file
+// system, as it's called while the Queue is locked; files stored before MediaFiles were tracked are found by name and
+// recorded in the background.
+func Resolve(media db.Media) (string, bool) {
+	if media.Type == "internal" {
+		return downloader.FilePath(media), true
+	}
+	files, err := db.GetMediaFiles(media)
+	if err != nil {
+		logrus.Errorf("could not look up files for media with id %v and type %v: %v", media.ID, media.Type, err)
+		return "", false
+	}
+	preferred := downloader.FilePath(media)
+	if len(files) == 0 {
+		return resolveLegacy(media, preferred)
+	}
+	var fallback string
+	for _, file := range files {
+		filePath := path.Join(viper.GetString(constants.DATA), file.Path)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			logrus.Warnf("stored file %v no longer exists, removing record", file.Path)
+			if err := db.DeleteMediaFile(file); err != nil {
+				logrus.Errorf("could not remove record of file %v: %v", file.Path, err)
+			}
+			continue
+		}
+		if file.Video != media.Video {
+			continue
+		}
+		if filePath == preferred {
+			return filePath, true
+		}
+		if fallback == "" {
+			fallback = filePath
+		}
+	}
+	return fallback, fallback != ""
+}
+
+// Remove deletes every stored file, the cached thumbnail and, for uploads, the original source of the given Media,
+// along with their records. Local sources outside of the data directory, such as library files, are never touched.
+func Remove(media db.Media) error {
+	files, err := db.GetMediaFiles(media)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		files = discover(media)
+	}
+	dataDir := viper.GetString(constants.DATA)
+	for _, file := range files {
+		if err := removeFile(path.Join(dataDir, file.Path)); err != nil {
+			return err
+		}
+		if err := db.DeleteMediaFile(file); err != nil {
+			return err
+		}
+	}
+	if err := removeFile(ThumbnailPath(media)); err != nil {
+		return err
+	}
+	if err := removeFile(failedThumbnailPath(media)); err != nil {
+		return err
+	}
+	if source, ok := downloader.LocalPath(media); ok {
+		if relative, err := filepath.Rel(dataDir, source); err == nil && !strings.HasPrefix(relative, "..") {
+			if err := removeFile(source); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeFile removes the file at filePath, ignoring files that don't exist.
+func removeFile(filePath string) error {
+	err := os.Remove(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	logrus.Debugf("removed file %v", filePath)
+	return nil
+}
+
+// resolveLegacy returns the path of a file for the given Media that was stored before MediaFiles were tracked,
+// preferring the one at preferred, and starts recording them in the background.
+func resolveLegacy(media db.Media, preferred string) (string, bool) {
+	var fallback string
+	for _, filePath := range legacyFiles(media) {
+		// Only .opus files were produced for audio; anything else was downloaded as video.
+		if (path.Ext(filePath) != ".opus") != media.Video {
+			continue
+		}
+		if filePath == preferred {
+			fallback = filePath
+			break
+		}
+		if fallback == "" {
+			fallback = filePath
+		}
+	}
+	if fallback != "" {
+		go discoverOnce(media)
+	}
+	return fallback, fallback != ""
+}
+
+// discoverOnce runs discover for the given Media unless it's already running for it.
+func discoverOnce(media db.Media) {
+	key := media.Type + "/" + media.ID
+	discovering.Lock()
+	if discovering.keys[key] {
+		discovering.Unlock()
+		return
+	}
+	discovering.keys[key] = true
+	discovering.Unlock()
+	defer func() {
+		discovering.Lock()
+		delete(discovering.keys, key)
+		discovering.Unlock()
+	}()
+	// Another run may have finished between the lookup in Resolve and now.
+	if files, err := db.GetMediaFiles(media); err == nil && len(files) > 0 {
+		return
+	}
+	discover(media)
+}
+
+// legacyFiles returns the paths of the files for the given Media that were stored before MediaFiles were tracked.
+func legacyFiles(media db.Media) []string {
+	dataDir := viper.GetString(constants.DATA)
+	files := make([]string, 0)
+	for _, ext := range legacyExtensions {
+		filePath := path.Join(dataDir, media.Type, media.ID+ext)
+		if _, err := os.Stat(filePath); err == nil {
+			files = append(files, filePath)
+		}
+	}
+	return files
+}
+
+// discover records any files for the given Media that were stored before MediaFiles were tracked and returns them.
+func discover(media db.Media) []db.MediaFile {
+	for _, filePath := range legacyFiles(media) {
+		// Only .opus files were produced for audio; anything else was downloaded as video.
+		variant := media
+		variant.Video = path.Ext(filePath) != ".opus"
+		if err := Record(variant, filePath, ""); err != nil {
+			logrus.Errorf("could not record existing file %v: %v", filePath, err)
+		}
+	}
+	files, err := db.GetMediaFiles(media)
+	if err != nil {
+		logrus.Errorf("could not look up files for media with id %v and type %v: %v", media.ID, media.Type, err)
+		return nil
+	}
+	return files
+}
+
+// checksum returns the hex-encoded SHA-256 checksum of the file at filePath.
+func checksum(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logrus.Errorf("error closing file %v: %v", filePath, err)
+		}
+	}()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Safety-Third/prismriver/internal/app/constants"
+	"github.com/Safety-Third/prismriver/internal/app/db"
+	"github.com/Safety-Third/prismriver/internal/app/downloader"
+)
+
+// thumbnailLock is held while the thumbnail of a single Media is being generated.
+type thumbnailLock struct {
+	sync.Mutex
+	users int
+}
+
+// thumbnailLocks holds a thumbnailLock for every Media whose thumbnail is being generated or waited on.
+var thumbnailLocks = struct {
+	sync.Mutex
+	locks map[string]*thumbnailLock
+}{locks: make(map[string]*thumbnailLock)}
+
+// ThumbnailPath returns the path that the cached thumbnail for the given Media is stored at.
+func ThumbnailPath(media db.Media) string {
+	return path.Join(viper.GetString(constants.DATA), media.Type, media.ID+".jpg")
+}
+
+// failedThumbnailPath returns the path of the marker that is left when no thumbnail could be extracted for the given
+// Media, so that extraction isn't attempted again on every request.
+func failedThumbnailPath(media db.Media) string {
+	return ThumbnailPath(media) + ".failed"
+}
+
+// Thumbnail returns the path of the cached thumbnail for the given Media, caching it first if needed. Media that a
+// thumbnail couldn't be extracted for before isn't tried again until it's downloaded again.
+func Thumbnail(media db.Media) (string, error) {
+	unlock := lockThumbnail(media)
+	defer unlock()
+	thumbnailPath := ThumbnailPath(media)
+	if _, err := os.Stat(thumbnailPath); err == nil {
+		return thumbnailPath, nil
+	}
+	if _, err := os.Stat(failedThumbnailPath(media)); err == nil {
+		return "", errors.Errorf("extracting a thumbnail for media with id %v and type %v failed before",
+			media.ID, media.Type)
+	}
+	if err := cacheThumbnail(media); err != nil {
+		return "", err
+	}
+	return thumbnailPath, nil
+}
+
+// CacheThumbnail stores a local copy of the thumbnail for the given Media. The thumbnail reported by the source is
+// used if there is one, otherwise a frame or the embedded cover art is extracted from the stored file.
+func CacheThumbnail(media db.Media) error {
+	unlock := lockThumbnail(media)
+	defer unlock()
+	return cacheThumbnail(media)
+}
+
+// cacheThumbnail does the work of CacheThumbnail. The caller must hold the thumbnailLock of the given Media.
+func cacheThumbnail(media db.Media) error {
+	thumbnailPath := ThumbnailPath(media)
+	if err := os.MkdirAll(path.Dir(thumbnailPath), os.ModeDir|0755); err != nil {
+		return err
+	}
+	if media.Thumbnail != "" {
+		// ffmpeg takes care of both fetching the image and converting formats such as WebP to JPEG.
+		err := extractFrame(media.Thumbnail, thumbnailPath)
+		if err == nil {
+			return removeFile(failedThumbnailPath(media))
+		}
+		logrus.Warnf("could not fetch thumbnail %v, extracting one instead: %v", media.Thumbnail, err)
+	}
+	source, ok := downloader.LocalPath(media)
+	if !ok {
+		if source, ok = Resolve(media); !ok {
+			return errors.Errorf("no stored file for media with id %v and type %v", media.ID, media.Type)
+		}
+	}
+	if err := extractFrame(source, thumbnailPath); err != nil {
+		if err := ioutil.WriteFile(failedThumbnailPath(media), nil, 0644); err != nil {
+			logrus.Errorf("could not remember failed thumbnail extraction: %v", err)
+		}
+		return err
+	}
+	return removeFile(failedThumbnailPath(media))
+}
+
+// lockThumbnail locks the thumbnailLock of the given Media and returns a function that unlocks it again.
+func lockThumbnail(media db.Media) func() {
+	key := media.Type + "/" + media.ID
+	thumbnailLocks.Lock()
+	lock, ok := thumbnailLocks.locks[key]
+	if !ok {
+		lock = &thumbnailLock{}
+		thumbnailLocks.locks[key] = lock
+	}
+	lock.users++
+	thumbnailLocks.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		thumbnailLocks.Lock()
+		defer thumbnailLocks.Unlock()
+		lock.users--
+		if lock.users == 0 {
+			delete(thumbnailLocks.locks, key)
+		}
+	}
+}
+
+// extractFrame uses ffmpeg to write a single representative frame of the input as a JPEG image. For audio files,
+// this is the embedded cover art. The image is written to a temporary file first, so that output never contains a
+// partial image.
+func extractFrame(input string, output string) error {
+	temp, err := ioutil.TempFile(path.Dir(output), path.Base(output)+"-*.jpg")
+	if err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := removeFile(temp.Name()); err != nil {
+			logrus.Errorf("could not remove temporary thumbnail %v: %v", temp.Name(), err)
+		}
+	}()
+	cmd := exec.Command("ffmpeg", "-v", "error", "-y", "-i", input, "-an", "-vf", "thumbnail", "-frames:v", "1",
+		temp.Name())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "ffmpeg failed: %s", out)
+	}
+	return os.Rename(temp.Name(), output)
+}